@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/digitorus/pdfsign/sign"
+)
+
+// signatureFields collects the repeatable -field flag.
+type signatureFields []sign.SignatureField
+
+func (f *signatureFields) String() string {
+	names := make([]string, len(*f))
+	for i, field := range *f {
+		names[i] = field.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *signatureFields) Set(value string) error {
+	field, err := ParseSignatureField(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, field)
+	return nil
+}
+
+// ParseSignatureField parses a field in the form name[,page[,llx,lly,urx,ury]].
+func ParseSignatureField(s string) (sign.SignatureField, error) {
+	parts := strings.Split(s, ",")
+	if parts[0] == "" {
+		return sign.SignatureField{}, fmt.Errorf("field name is required")
+	}
+
+	field := sign.SignatureField{
+		Name: parts[0],
+	}
+
+	if len(parts) > 1 {
+		page, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return sign.SignatureField{}, fmt.Errorf("invalid page %q: %w", parts[1], err)
+		}
+		field.Page = uint32(page)
+	}
+
+	switch len(parts) {
+	case 1, 2:
+	case 6:
+		var rect [4]float64
+		for i, part := range parts[2:] {
+			value, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return sign.SignatureField{}, fmt.Errorf("invalid coordinate %q: %w", part, err)
+			}
+			rect[i] = value
+		}
+		field.LowerLeftX, field.LowerLeftY, field.UpperRightX, field.UpperRightY = rect[0], rect[1], rect[2], rect[3]
+	default:
+		return sign.SignatureField{}, fmt.Errorf("invalid field %q, expected name[,page[,llx,lly,urx,ury]]", s)
+	}
+
+	return field, nil
+}
+
+func AddFieldCommand() {
+	addFieldFlags := flag.NewFlagSet("add-field", flag.ExitOnError)
+
+	var fields signatureFields
+	addFieldFlags.Var(&fields, "field", "Signature field as name[,page[,llx,lly,urx,ury]], may be repeated")
+	addFieldFlags.BoolVar(&IgnoreDocMDP, "ignore-docmdp", false, "Add the fields to a certified document even when they invalidate the certification")
+
+	addFieldFlags.Usage = func() {
+		fmt.Printf("Usage: %s add-field [options] <input.pdf> <output.pdf>\n\n", os.Args[0])
+		fmt.Println("Add empty signature fields to a PDF file")
+		fmt.Println("\nOptions:")
+		addFieldFlags.PrintDefaults()
+		fmt.Println("\nExamples:")
+		fmt.Printf("  %s add-field -field approver,1,100,100,300,150 input.pdf output.pdf\n", os.Args[0])
+		fmt.Printf("  %s add-field -field approver,1,100,100,300,150 -field reviewer,2,100,100,300,150 input.pdf output.pdf\n", os.Args[0])
+	}
+
+	if err := addFieldFlags.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse add-field flags: %v", err)
+	}
+
+	if len(addFieldFlags.Args()) < 2 || len(fields) == 0 {
+		addFieldFlags.Usage()
+		osExit(1)
+	}
+
+	input := addFieldFlags.Arg(0)
+	output := addFieldFlags.Arg(1)
+
+	if err := sign.AddSignatureFieldsFile(input, output, fields, sign.SignatureFieldsOptions{IgnoreDocMDP: IgnoreDocMDP}); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("PDF with signature fields written to " + output)
+}
@@ -129,3 +129,53 @@ func TestSignCommand_FlagParsing(t *testing.T) {
 		t.Error("SignPDF should not be called for insufficient args")
 	}
 }
+
+func TestParseSignatureField(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected sign.SignatureField
+		wantErr  bool
+	}{
+		{"approver", sign.SignatureField{Name: "approver"}, false},
+		{"approver,2", sign.SignatureField{Name: "approver", Page: 2}, false},
+		{"approver,1,100,100,300,150.5", sign.SignatureField{Name: "approver", Page: 1, LowerLeftX: 100, LowerLeftY: 100, UpperRightX: 300, UpperRightY: 150.5}, false},
+		{"", sign.SignatureField{}, true},
+		{"approver,x", sign.SignatureField{}, true},
+		{"approver,1,100,100", sign.SignatureField{}, true},
+		{"approver,1,100,100,300,y", sign.SignatureField{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseSignatureField(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSignatureField() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseSignatureField() unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseSignatureField() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOpenPKCS11(t *testing.T) {
+	origModule, origKeyID := PKCS11Module, PKCS11KeyID
+	defer func() { PKCS11Module, PKCS11KeyID = origModule, origKeyID }()
+
+	PKCS11Module = t.TempDir() + "/missing.so"
+
+	PKCS11KeyID = "not hex"
+	if _, err := openPKCS11(); err == nil {
+		t.Error("expected an error for an invalid key ID")
+	}
+
+	PKCS11KeyID = "01"
+	if _, err := openPKCS11(); err == nil {
+		t.Error("expected an error for a missing module")
+	}
+}
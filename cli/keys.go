@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// KeyPasswordEnv is the environment variable with the password of the private
+// key or PKCS #12 file, the -key-password flags take precedence.
+const KeyPasswordEnv = "PDFSIGN_KEY_PASSWORD"
+
+var (
+	// RFC 8018
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is EncryptedPrivateKeyInfo (RFC 5958).
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is PBES2-params (RFC 8018).
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is PBKDF2-params (RFC 8018), only a specified salt is
+// supported.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// keyPassword returns the password from the -key-password or
+// -key-password-file flag, or from the environment.
+func keyPassword() (string, error) {
+	if KeyPassword != "" {
+		return KeyPassword, nil
+	}
+	if KeyPasswordFile != "" {
+		data, err := os.ReadFile(KeyPasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(KeyPasswordEnv), nil
+}
+
+// isPKCS12 reports whether the file is a PKCS #12 bundle by its extension.
+func isPKCS12(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		return true
+	}
+	return false
+}
+
+// ParsePrivateKey parses a PEM or DER encoded private key: PKCS #1 RSA, SEC 1
+// EC or PKCS #8, encrypted PKCS #8 (PBES2 with AES) or a legacy encrypted PEM
+// block.
+func ParsePrivateKey(data []byte, password string) (crypto.Signer, error) {
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		der := block.Bytes
+		switch block.Type {
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+			if isLegacyEncryptedPEM(block) {
+				var err error
+				der, err = decryptLegacyPEM(block, password)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "ENCRYPTED PRIVATE KEY":
+			var err error
+			der, err = decryptPKCS8(der, password)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			// For example EC PARAMETERS or a certificate.
+			continue
+		}
+
+		return parseDERPrivateKey(der)
+	}
+
+	if _, err := asn1.Unmarshal(data, &asn1.RawValue{}); err == nil {
+		if key, err := parseDERPrivateKey(data); err == nil {
+			return key, nil
+		}
+		// An unencrypted DER key failed, try an encrypted one.
+		if der, err := decryptPKCS8(data, password); err == nil {
+			return parseDERPrivateKey(der)
+		}
+	}
+
+	return nil, errors.New("failed to parse private key as PEM or DER")
+}
+
+// isLegacyEncryptedPEM reports whether the block uses the legacy OpenSSL
+// encryption (Proc-Type: 4,ENCRYPTED).
+func isLegacyEncryptedPEM(block *pem.Block) bool {
+	//nolint:staticcheck // SA1019: legacy encrypted keys are written by OpenSSL 1.x and with -traditional.
+	return x509.IsEncryptedPEMBlock(block)
+}
+
+// decryptLegacyPEM decrypts a legacy encrypted PEM block. The format is
+// deprecated as it can't be authenticated, a wrong password may only be
+// detected when the key is parsed. It is kept for existing keys, new keys
+// should be encrypted PKCS #8 or PKCS #12.
+func decryptLegacyPEM(block *pem.Block, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("private key is encrypted, a password is required")
+	}
+
+	//nolint:staticcheck // SA1019: see isLegacyEncryptedPEM, the padding oracle doesn't apply to local key files.
+	der, err := x509.DecryptPEMBlock(block, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	return der, nil
+}
+
+// parseDERPrivateKey parses a PKCS #8, PKCS #1 or SEC 1 private key.
+func parseDERPrivateKey(der []byte) (crypto.Signer, error) {
+	var key any
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil, errors.New("failed to parse private key as PKCS #8, PKCS #1 or SEC 1")
+			}
+		}
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo using PBES2 with PBKDF2
+// and AES-CBC, the scheme used by OpenSSL.
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted private key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s", info.Algorithm.Algorithm)
+	}
+	if password == "" {
+		return nil, errors.New("private key is encrypted, a password is required")
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", kdf.PRF.Algorithm)
+	}
+
+	var key_length int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		key_length = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		key_length = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		key_length = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s", params.EncryptionScheme.Algorithm)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != key_length {
+		return nil, fmt.Errorf("invalid PBKDF2 key length %d", kdf.KeyLength)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("invalid AES-CBC initialization vector")
+	}
+
+	key, err := pbkdf2.Key(prf, password, kdf.Salt, kdf.IterationCount, key_length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	// A wrong password almost always results in invalid padding.
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("failed to decrypt private key: incorrect password")
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// ParsePKCS12 returns the certificate, private key and certificate chain of
+// a PKCS #12 (.p12 or .pfx) bundle. The chain starts with the certificate,
+// followed by the issuers found in the bundle.
+func ParsePKCS12(data []byte, password string) (*x509.Certificate, crypto.Signer, [][]*x509.Certificate, error) {
+	key, cert, ca_certs, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decode PKCS #12: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	chain := []*x509.Certificate{cert}
+	for current := cert; !bytes.Equal(current.RawIssuer, current.RawSubject); {
+		var issuer *x509.Certificate
+		for _, ca_cert := range ca_certs {
+			if bytes.Equal(ca_cert.RawSubject, current.RawIssuer) && current.CheckSignatureFrom(ca_cert) == nil {
+				issuer = ca_cert
+				break
+			}
+		}
+		if issuer == nil || len(chain) > len(ca_certs) {
+			break
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+
+	return cert, signer, [][]*x509.Certificate{chain}, nil
+}
@@ -0,0 +1,42 @@
+//go:build cgo
+
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/digitorus/pdfsign/pkcs11"
+)
+
+// openPKCS11 opens the token selected by the PKCS #11 flags.
+func openPKCS11() (tokenSigner, error) {
+	config := pkcs11.Config{
+		Module:     PKCS11Module,
+		TokenLabel: PKCS11Token,
+		PIN:        PKCS11PIN,
+		KeyLabel:   PKCS11KeyLabel,
+	}
+	if config.PIN == "" {
+		config.PIN = os.Getenv("PKCS11_PIN")
+	}
+	if PKCS11Slot >= 0 {
+		slot := uint(PKCS11Slot)
+		config.Slot = &slot
+	}
+	if PKCS11KeyID != "" {
+		id, err := hex.DecodeString(PKCS11KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PKCS #11 key ID: %w", err)
+		}
+		config.KeyID = id
+	}
+
+	signer, err := pkcs11.Open(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package cli
+
+import "errors"
+
+// openPKCS11 is unavailable, the PKCS #11 module is loaded through cgo.
+func openPKCS11() (tokenSigner, error) {
+	return nil, errors.New("PKCS #11 signing requires a build with cgo enabled")
+}
@@ -16,9 +16,21 @@ import (
 
 var (
 	InfoName, InfoLocation, InfoReason, InfoContact, TSA string
-	CertType                                             string
+	CertType, FieldName                                  string
+	KeyPassword, KeyPasswordFile                         string
+	RSAPSS, IgnoreDocMDP                                 bool
+
+	PKCS11Module, PKCS11Token, PKCS11PIN, PKCS11KeyLabel, PKCS11KeyID string
+	PKCS11Slot                                                        int
 )
 
+// tokenSigner is a signer on a PKCS #11 token.
+type tokenSigner interface {
+	crypto.Signer
+	Certificate() *x509.Certificate
+	Close() error
+}
+
 func ParseCertType(s string) (sign.CertType, error) {
 	switch s {
 	case sign.CertificationSignature.String():
@@ -42,16 +54,30 @@ func SignCommand() {
 	signFlags.StringVar(&InfoReason, "reason", "", "Reason for signing")
 	signFlags.StringVar(&InfoContact, "contact", "", "Contact information for signatory")
 	signFlags.StringVar(&TSA, "tsa", "https://freetsa.org/tsr", "URL for Time-Stamp Authority")
+	signFlags.StringVar(&FieldName, "field", "", "Name of an existing empty signature field to sign")
+	signFlags.StringVar(&KeyPassword, "key-password", "", "Password of the private key or PKCS #12 file (default $"+KeyPasswordEnv+")")
+	signFlags.StringVar(&KeyPasswordFile, "key-password-file", "", "File containing the password of the private key or PKCS #12 file")
+	signFlags.BoolVar(&RSAPSS, "rsa-pss", false, "Create an RSASSA-PSS signature instead of PKCS #1 v1.5 (RSA keys only)")
+	signFlags.BoolVar(&IgnoreDocMDP, "ignore-docmdp", false, "Sign a certified document even when the signature invalidates the certification")
+	signFlags.StringVar(&PKCS11Module, "pkcs11", "", "Path of a PKCS #11 module to sign with a key on a token")
+	signFlags.StringVar(&PKCS11Token, "pkcs11-token", "", "Label of the PKCS #11 token")
+	signFlags.IntVar(&PKCS11Slot, "pkcs11-slot", -1, "Slot ID of the PKCS #11 token")
+	signFlags.StringVar(&PKCS11PIN, "pkcs11-pin", "", "User PIN of the PKCS #11 token (default $PKCS11_PIN)")
+	signFlags.StringVar(&PKCS11KeyLabel, "pkcs11-key-label", "", "Label of the private key on the PKCS #11 token")
+	signFlags.StringVar(&PKCS11KeyID, "pkcs11-key-id", "", "Hex encoded ID of the private key on the PKCS #11 token")
 	signFlags.StringVar(&CertType, "certType", "CertificationSignature", "Type of the certificate (CertificationSignature, ApprovalSignature, UsageRightsSignature, TimeStampSignature)")
 
 	signFlags.Usage = func() {
-		fmt.Printf("Usage: %s sign [options] <input.pdf> <output.pdf> <certificate.crt> <private_key.key> [chain.crt]\n\n", os.Args[0])
+		fmt.Printf("Usage: %s sign [options] <input.pdf> <output.pdf> <certificate.crt> <private_key.key> [chain.crt]\n", os.Args[0])
+		fmt.Printf("       %s sign [options] <input.pdf> <output.pdf> <bundle.p12> [chain.crt]\n", os.Args[0])
+		fmt.Printf("       %s sign -pkcs11 <module.so> [options] <input.pdf> <output.pdf> [chain.crt]\n\n", os.Args[0])
 		fmt.Println("Sign a PDF file with a digital signature")
 		fmt.Println("\nOptions:")
 		signFlags.PrintDefaults()
 		fmt.Println("\nExamples:")
 		fmt.Printf("  %s sign -name \"John Doe\" input.pdf output.pdf cert.crt key.key\n", os.Args[0])
 		fmt.Printf("  %s sign -certType \"TimeStampSignature\" input.pdf output.pdf\n", os.Args[0])
+		fmt.Printf("  %s sign -pkcs11 /usr/lib/softhsm/libsofthsm2.so -pkcs11-token signing -pkcs11-key-label key input.pdf output.pdf\n", os.Args[0])
 	}
 
 	if err := signFlags.Parse(os.Args[2:]); err != nil {
@@ -86,20 +112,56 @@ func signPDFImpl(input string, args []string) {
 		return
 	}
 
-	if len(args) < 4 {
-		fmt.Fprintf(os.Stderr, "Signing requires: input.pdf output.pdf certificate.crt private_key.key [chain.crt]\n")
-		osExit(1)
-	}
+	var cert *x509.Certificate
+	var pkey crypto.Signer
+	var certificateChains [][]*x509.Certificate
+	var output string
 
-	output := args[1]
-	certPath := args[2]
-	keyPath := args[3]
-	var chainPath string
-	if len(args) > 4 {
-		chainPath = args[4]
-	}
+	if PKCS11Module != "" {
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "PKCS #11 signing requires: input.pdf output.pdf [chain.crt]\n")
+			osExit(1)
+		}
+		output = args[1]
+
+		token, err := openPKCS11()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := token.Close(); err != nil {
+				log.Printf("failed to close PKCS #11 token: %v", err)
+			}
+		}()
+
+		cert, pkey = token.Certificate(), token
+		if len(args) > 2 {
+			certificateChains = LoadCertificateChain(args[2], cert)
+		}
+	} else if len(args) > 2 && isPKCS12(args[2]) {
+		output = args[1]
+		var chainPath string
+		if len(args) > 3 {
+			chainPath = args[3]
+		}
+
+		cert, pkey, certificateChains = LoadPKCS12(args[2], chainPath)
+	} else {
+		if len(args) < 4 {
+			fmt.Fprintf(os.Stderr, "Signing requires: input.pdf output.pdf certificate.crt private_key.key [chain.crt]\n")
+			osExit(1)
+		}
+
+		output = args[1]
+		certPath := args[2]
+		keyPath := args[3]
+		var chainPath string
+		if len(args) > 4 {
+			chainPath = args[4]
+		}
 
-	cert, pkey, certificateChains := LoadCertificatesAndKey(certPath, keyPath, chainPath)
+		cert, pkey, certificateChains = LoadCertificatesAndKey(certPath, keyPath, chainPath)
+	}
 
 	err = sign.SignFile(input, output, sign.SignData{
 		Signature: sign.SignDataSignature{
@@ -113,6 +175,9 @@ func signPDFImpl(input string, args []string) {
 			CertType:   certTypeValue,
 			DocMDPPerm: sign.AllowFillingExistingFormFieldsAndSignaturesPerms,
 		},
+		FieldName:         FieldName,
+		RSAPSS:            RSAPSS,
+		IgnoreDocMDP:      IgnoreDocMDP,
 		Signer:            pkey,
 		DigestAlgorithm:   crypto.SHA256,
 		Certificate:       cert,
@@ -156,12 +221,12 @@ func LoadCertificatesAndKey(certPath, keyPath, chainPath string) (*x509.Certific
 		log.Fatal(err)
 	}
 
-	keyBlock, _ := pem.Decode(keyData)
-	if keyBlock == nil {
-		log.Fatal(errors.New("failed to parse PEM block containing the private key"))
+	password, err := keyPassword()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	pkey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	pkey, err := ParsePrivateKey(keyData, password)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -174,6 +239,31 @@ func LoadCertificatesAndKey(certPath, keyPath, chainPath string) (*x509.Certific
 	return cert, pkey, certificateChains
 }
 
+// LoadPKCS12 loads the certificate, private key and chain of a PKCS #12
+// bundle, a chain file replaces the chain of the bundle.
+func LoadPKCS12(path, chainPath string) (*x509.Certificate, crypto.Signer, [][]*x509.Certificate) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	password, err := keyPassword()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cert, pkey, certificateChains, err := ParsePKCS12(data, password)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if chainPath != "" {
+		certificateChains = LoadCertificateChain(chainPath, cert)
+	}
+
+	return cert, pkey, certificateChains
+}
+
 func LoadCertificateChain(chainPath string, cert *x509.Certificate) [][]*x509.Certificate {
 	chainData, err := os.ReadFile(chainPath)
 	if err != nil {
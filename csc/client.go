@@ -0,0 +1,268 @@
+// Package csc implements a client for the Cloud Signature Consortium API v2,
+// used by trust service providers for remote signing with keys in a QSCD.
+package csc
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client calls the CSC API of a remote signing service.
+type Client struct {
+	// BaseURL is the base URI of the service including the version, for
+	// example https://example.com/csc/v2.
+	BaseURL string
+
+	// AccessToken is the OAuth 2.0 bearer token sent with each request.
+	AccessToken string
+
+	// HTTPClient is used for the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// Error is an error response of the service.
+type Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("csc: %s (%d): %s", e.Code, e.StatusCode, e.Description)
+	}
+	return fmt.Sprintf("csc: %s (%d)", e.Code, e.StatusCode)
+}
+
+// KeyInfo describes the key of a credential.
+type KeyInfo struct {
+	Status string   `json:"status"`
+	Algo   []string `json:"algo"`
+	Len    int      `json:"len"`
+	Curve  string   `json:"curve,omitempty"`
+}
+
+// CertificateInfo describes the certificate of a credential, Certificates
+// contains the base64 encoded DER certificates starting with the end entity.
+type CertificateInfo struct {
+	Status       string   `json:"status"`
+	Certificates []string `json:"certificates"`
+	IssuerDN     string   `json:"issuerDN,omitempty"`
+	SerialNumber string   `json:"serialNumber,omitempty"`
+	SubjectDN    string   `json:"subjectDN,omitempty"`
+	ValidFrom    string   `json:"validFrom,omitempty"`
+	ValidTo      string   `json:"validTo,omitempty"`
+}
+
+// AuthInfo describes how signing with a credential is authorized.
+type AuthInfo struct {
+	Mode string `json:"mode"`
+}
+
+// CredentialInfo is the response of credentials/info.
+type CredentialInfo struct {
+	Description        string          `json:"description,omitempty"`
+	SignatureQualifier string          `json:"signatureQualifier,omitempty"`
+	Key                KeyInfo         `json:"key"`
+	Cert               CertificateInfo `json:"cert"`
+	Auth               AuthInfo        `json:"auth"`
+	SCAL               string          `json:"SCAL,omitempty"`
+	Multisign          int             `json:"multisign"`
+}
+
+// Certificates parses the certificates of the credential.
+func (info *CredentialInfo) Certificates() ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for i, encoded := range info.Cert.Certificates {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode certificate %d: %w", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d: %w", i, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, nil
+}
+
+// SignHashRequest are the parameters of signatures/signHash, SignAlgo and
+// HashAlgorithmOID are dotted OIDs.
+type SignHashRequest struct {
+	CredentialID     string
+	SAD              string
+	Hashes           [][]byte
+	HashAlgorithmOID string
+	SignAlgo         string
+	SignAlgoParams   []byte
+}
+
+// ListCredentials returns the credential IDs of the user, userID may be empty
+// when the access token identifies the user.
+func (c *Client) ListCredentials(ctx context.Context, userID string) ([]string, error) {
+	request := map[string]any{}
+	if userID != "" {
+		request["userID"] = userID
+	}
+
+	var response struct {
+		CredentialIDs []string `json:"credentialIDs"`
+	}
+	if err := c.call(ctx, "credentials/list", request, &response); err != nil {
+		return nil, err
+	}
+
+	return response.CredentialIDs, nil
+}
+
+// CredentialInfo returns the key, the certificate chain and the authorization
+// mode of the credential.
+func (c *Client) CredentialInfo(ctx context.Context, credentialID string) (*CredentialInfo, error) {
+	request := map[string]any{
+		"credentialID": credentialID,
+		"certificates": "chain",
+		"certInfo":     true,
+		"authInfo":     true,
+	}
+
+	var response CredentialInfo
+	if err := c.call(ctx, "credentials/info", request, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Authorize authorizes signing the hashes with the credential using explicit
+// authorization, it returns the Signature Activation Data (SAD).
+func (c *Client) Authorize(ctx context.Context, credentialID string, hashes [][]byte, hashAlgorithmOID, pin, otp string) (string, error) {
+	request := map[string]any{
+		"credentialID":  credentialID,
+		"numSignatures": len(hashes),
+		"hashes":        encodeHashes(hashes),
+	}
+	if hashAlgorithmOID != "" {
+		request["hashAlgorithmOID"] = hashAlgorithmOID
+	}
+	if pin != "" {
+		request["PIN"] = pin
+	}
+	if otp != "" {
+		request["OTP"] = otp
+	}
+
+	var response struct {
+		SAD string `json:"SAD"`
+	}
+	if err := c.call(ctx, "credentials/authorize", request, &response); err != nil {
+		return "", err
+	}
+	if response.SAD == "" {
+		return "", errors.New("csc: authorization returned no SAD")
+	}
+
+	return response.SAD, nil
+}
+
+// SignHash signs the hashes, one signature is returned for each hash.
+func (c *Client) SignHash(ctx context.Context, r SignHashRequest) ([][]byte, error) {
+	request := map[string]any{
+		"credentialID": r.CredentialID,
+		"SAD":          r.SAD,
+		"hashes":       encodeHashes(r.Hashes),
+		"signAlgo":     r.SignAlgo,
+	}
+	if r.HashAlgorithmOID != "" {
+		request["hashAlgorithmOID"] = r.HashAlgorithmOID
+	}
+	if len(r.SignAlgoParams) > 0 {
+		request["signAlgoParams"] = base64.StdEncoding.EncodeToString(r.SignAlgoParams)
+	}
+
+	var response struct {
+		Signatures []string `json:"signatures"`
+	}
+	if err := c.call(ctx, "signatures/signHash", request, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Signatures) != len(r.Hashes) {
+		return nil, fmt.Errorf("csc: expected %d signatures, got %d", len(r.Hashes), len(response.Signatures))
+	}
+
+	signatures := make([][]byte, len(response.Signatures))
+	for i, encoded := range response.Signatures {
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("csc: failed to decode signature %d: %w", i, err)
+		}
+		signatures[i] = signature
+	}
+
+	return signatures, nil
+}
+
+// call posts the JSON request to the method and decodes the JSON response.
+func (c *Client) call(ctx context.Context, method string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("csc: failed to encode %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("csc: failed to prepare %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("csc: %s request failed: %w", method, err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	close_err := resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("csc: failed to read %s response: %w", method, err)
+	}
+	if close_err != nil {
+		return fmt.Errorf("csc: failed to close %s response: %w", method, close_err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, e) != nil || e.Code == "" {
+			e.Code = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("csc: failed to decode %s response: %w", method, err)
+	}
+
+	return nil
+}
+
+func encodeHashes(hashes [][]byte) []string {
+	encoded := make([]string, len(hashes))
+	for i, hash := range hashes {
+		encoded[i] = base64.StdEncoding.EncodeToString(hash)
+	}
+	return encoded
+}
@@ -0,0 +1,332 @@
+package csc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+const (
+	testToken = "token"
+	testPIN   = "12345678"
+)
+
+// testCredential is a credential of the test service.
+type testCredential struct {
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+// createChain returns a certificate for the key issued by a new CA.
+func createChain(t *testing.T, key crypto.Signer) []*x509.Certificate {
+	t.Helper()
+
+	ca_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca_template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test QTSP CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca_der, err := x509.CreateCertificate(rand.Reader, ca_template, ca_template, ca_key.Public(), ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(ca_der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "John Doe"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []*x509.Certificate{cert, ca}
+}
+
+// newTestService returns a CSC service that signs with the credentials, SADs
+// are bound to the authorized hash.
+func newTestService(t *testing.T, credentials map[string]testCredential) *httptest.Server {
+	t.Helper()
+
+	sads := map[string]string{}
+	fail := func(w http.ResponseWriter, status int, code, description string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			fail(w, http.StatusUnauthorized, "invalid_token", "invalid access token")
+			return
+		}
+
+		var request struct {
+			CredentialID     string   `json:"credentialID"`
+			Hashes           []string `json:"hashes"`
+			HashAlgorithmOID string   `json:"hashAlgorithmOID"`
+			PIN              string   `json:"PIN"`
+			SAD              string   `json:"SAD"`
+			SignAlgo         string   `json:"signAlgo"`
+			SignAlgoParams   string   `json:"signAlgoParams"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fail(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		credential, found := credentials[request.CredentialID]
+
+		var response any
+		switch r.URL.Path {
+		case "/csc/v2/credentials/list":
+			var ids []string
+			for id := range credentials {
+				ids = append(ids, id)
+			}
+			response = map[string]any{"credentialIDs": ids}
+		case "/csc/v2/credentials/info":
+			if !found {
+				fail(w, http.StatusBadRequest, "invalid_request", "invalid credentialID")
+				return
+			}
+			var certificates []string
+			for _, cert := range credential.chain {
+				certificates = append(certificates, base64.StdEncoding.EncodeToString(cert.Raw))
+			}
+			response = map[string]any{
+				"key":  map[string]any{"status": "enabled", "algo": []string{}, "len": 256},
+				"cert": map[string]any{"status": "valid", "certificates": certificates},
+				"auth": map[string]any{"mode": "explicit"},
+				"SCAL": "2",
+			}
+		case "/csc/v2/credentials/authorize":
+			if !found || request.PIN != testPIN || len(request.Hashes) != 1 {
+				fail(w, http.StatusBadRequest, "invalid_request", "authorization failed")
+				return
+			}
+			sad := base64.StdEncoding.EncodeToString([]byte(request.CredentialID + request.Hashes[0]))
+			sads[sad] = request.Hashes[0]
+			response = map[string]any{"SAD": sad, "expiresIn": 300}
+		case "/csc/v2/signatures/signHash":
+			if !found || len(request.Hashes) != 1 || sads[request.SAD] != request.Hashes[0] {
+				fail(w, http.StatusBadRequest, "invalid_request", "invalid SAD")
+				return
+			}
+			digest, _ := base64.StdEncoding.DecodeString(request.Hashes[0])
+
+			var opts crypto.SignerOpts = crypto.SHA256
+			switch request.HashAlgorithmOID {
+			case algorithm.HashOIDs[crypto.SHA384].String():
+				opts = crypto.SHA384
+			case algorithm.HashOIDs[crypto.SHA512].String():
+				opts = crypto.SHA512
+			}
+			if request.SignAlgo == algorithm.OIDRSASSAPSS.String() {
+				if request.SignAlgoParams == "" {
+					fail(w, http.StatusBadRequest, "invalid_request", "missing signAlgoParams")
+					return
+				}
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: opts.HashFunc()}
+			}
+
+			signature, err := credential.key.Sign(rand.Reader, digest, opts)
+			if err != nil {
+				fail(w, http.StatusBadRequest, "invalid_request", err.Error())
+				return
+			}
+
+			// Return ECDSA signatures as r || s.
+			if _, ok := credential.key.(*ecdsa.PrivateKey); ok {
+				var parsed struct{ R, S *big.Int }
+				_, _ = asn1.Unmarshal(signature, &parsed)
+				signature = append(parsed.R.FillBytes(make([]byte, 32)), parsed.S.FillBytes(make([]byte, 32))...)
+			}
+			response = map[string]any{"signatures": []string{base64.StdEncoding.EncodeToString(signature)}}
+		default:
+			fail(w, http.StatusNotFound, "invalid_request", "unknown method")
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestSigner(t *testing.T) {
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsa_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, map[string]testCredential{
+		"rsa":   {rsa_key, createChain(t, rsa_key)},
+		"ecdsa": {ecdsa_key, createChain(t, ecdsa_key)},
+	})
+	defer service.Close()
+
+	client := &Client{BaseURL: service.URL + "/csc/v2/", AccessToken: testToken}
+	ctx := context.Background()
+
+	ids, err := client.ListCredentials(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected 2 credentials, got %v", ids)
+	}
+
+	rsa_signer, err := NewSigner(ctx, client, "rsa", testPIN, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rsa_signer.CertificateChains()[0]) != 2 {
+		t.Error("expected the chain of credentials/info")
+	}
+
+	digest := sha256.Sum256([]byte("content"))
+	signature, err := rsa_signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(&rsa_key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("invalid PKCS #1 v1.5 signature: %s", err)
+	}
+
+	pss := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	signature, err = rsa_signer.Sign(rand.Reader, digest[:], pss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPSS(&rsa_key.PublicKey, crypto.SHA256, digest[:], signature, pss); err != nil {
+		t.Errorf("invalid RSASSA-PSS signature: %s", err)
+	}
+
+	ecdsa_signer, err := NewSigner(ctx, client, "ecdsa", testPIN, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err = ecdsa_signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&ecdsa_key.PublicKey, digest[:], signature) {
+		t.Error("invalid ECDSA signature")
+	}
+
+	// Sign a document remotely.
+	for _, signer := range []*Signer{rsa_signer, ecdsa_signer} {
+		output := filepath.Join(t.TempDir(), "signed.pdf")
+		err := sign.SignFile("../testfiles/testfile20.pdf", output, sign.SignData{
+			Signature: sign.SignDataSignature{
+				Info: sign.SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: sign.ApprovalSignature,
+			},
+			DigestAlgorithm:   crypto.SHA256,
+			Signer:            signer,
+			Certificate:       signer.Certificate(),
+			CertificateChains: signer.CertificateChains(),
+		})
+		if err != nil {
+			t.Fatalf("failed to sign: %s", err)
+		}
+
+		file, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := verify.VerifyFile(file)
+		_ = file.Close()
+		if err != nil {
+			t.Fatalf("failed to verify: %s", err)
+		}
+		if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+			t.Errorf("expected a valid signature, got %+v", response)
+		}
+		if len(response.Signers[0].Certificates) != 2 {
+			t.Errorf("expected the chain in the signature, got %d certificates", len(response.Signers[0].Certificates))
+		}
+	}
+}
+
+func TestSignerErrors(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, map[string]testCredential{
+		"rsa": {key, createChain(t, key)},
+	})
+	defer service.Close()
+
+	ctx := context.Background()
+
+	client := &Client{BaseURL: service.URL + "/csc/v2", AccessToken: "invalid"}
+	_, err = client.ListCredentials(ctx, "")
+	var csc_error *Error
+	if !errors.As(err, &csc_error) || csc_error.Code != "invalid_token" || csc_error.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an invalid_token error, got %v", err)
+	}
+
+	client.AccessToken = testToken
+	if _, err := NewSigner(ctx, client, "unknown", testPIN, ""); err == nil {
+		t.Error("expected an error for an unknown credential")
+	}
+
+	signer, err := NewSigner(ctx, client, "rsa", "wrong", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("content"))
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+		t.Error("expected an error for a wrong PIN")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:16], crypto.SHA256); err == nil {
+		t.Error("expected an error for a short digest")
+	}
+}
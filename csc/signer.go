@@ -0,0 +1,180 @@
+package csc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+)
+
+var oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+// ecdsaOIDs are the ecdsa-with-SHA* signature algorithms (RFC 5758).
+var ecdsaOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   {1, 2, 840, 10045, 4, 1},
+	crypto.SHA256: {1, 2, 840, 10045, 4, 3, 2},
+	crypto.SHA384: {1, 2, 840, 10045, 4, 3, 3},
+	crypto.SHA512: {1, 2, 840, 10045, 4, 3, 4},
+}
+
+// Signer signs with a remote CSC credential. Each signature is authorized
+// for its hash with the PIN and OTP, as required for SCAL2 credentials.
+type Signer struct {
+	client       *Client
+	credentialID string
+	pin, otp     string
+	certificates []*x509.Certificate
+}
+
+// NewSigner returns a signer for the credential, the certificate chain is
+// read from credentials/info. The pin and otp are used to authorize each
+// signature and may be empty.
+func NewSigner(ctx context.Context, client *Client, credentialID, pin, otp string) (*Signer, error) {
+	info, err := client.CredentialInfo(ctx, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if info.Key.Status != "" && info.Key.Status != "enabled" {
+		return nil, fmt.Errorf("csc: key of credential %s is %s", credentialID, info.Key.Status)
+	}
+
+	certificates, err := info.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("csc: credential %s has no certificate", credentialID)
+	}
+
+	switch certificates[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("csc: unsupported public key type %T", certificates[0].PublicKey)
+	}
+
+	return &Signer{
+		client:       client,
+		credentialID: credentialID,
+		pin:          pin,
+		otp:          otp,
+		certificates: certificates,
+	}, nil
+}
+
+// Certificate returns the certificate of the credential.
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.certificates[0]
+}
+
+// CertificateChains returns the certificate chain of the credential in the
+// form used by sign.SignData.
+func (s *Signer) CertificateChains() [][]*x509.Certificate {
+	return [][]*x509.Certificate{s.certificates}
+}
+
+// Public returns the public key of the certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.certificates[0].PublicKey
+}
+
+// Sign authorizes and signs the digest remotely. RSA keys sign with PKCS #1
+// v1.5, or RSASSA-PSS when opts is *rsa.PSSOptions, ECDSA signatures are
+// returned ASN.1 encoded.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.SignContext(context.Background(), digest, opts)
+}
+
+// SignContext is Sign with a context for the requests.
+func (s *Signer) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	hash_oid, ok := algorithm.HashOIDs[hash]
+	if !ok {
+		return nil, fmt.Errorf("csc: unsupported hash algorithm %s", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("csc: digest length %d doesn't match %s", len(digest), hash)
+	}
+
+	request := SignHashRequest{
+		CredentialID:     s.credentialID,
+		Hashes:           [][]byte{digest},
+		HashAlgorithmOID: hash_oid.String(),
+	}
+
+	switch s.Public().(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			params, err := pssParams(hash, pss.SaltLength)
+			if err != nil {
+				return nil, err
+			}
+			request.SignAlgo = algorithm.OIDRSASSAPSS.String()
+			request.SignAlgoParams = params
+		} else {
+			request.SignAlgo = oidRSAEncryption.String()
+		}
+	case *ecdsa.PublicKey:
+		request.SignAlgo = ecdsaOIDs[hash].String()
+	}
+
+	sad, err := s.client.Authorize(ctx, s.credentialID, request.Hashes, request.HashAlgorithmOID, s.pin, s.otp)
+	if err != nil {
+		return nil, err
+	}
+	request.SAD = sad
+
+	signatures, err := s.client.SignHash(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if public_key, ok := s.Public().(*ecdsa.PublicKey); ok {
+		return ecdsaSignature(public_key, signatures[0])
+	}
+
+	return signatures[0], nil
+}
+
+// pssParams returns the DER encoded RSASSA-PSS parameters for MGF1 with the
+// same hash, rsa.PSSSaltLengthAuto uses the hash length.
+func pssParams(hash crypto.Hash, salt_length int) ([]byte, error) {
+	switch {
+	case salt_length == rsa.PSSSaltLengthEqualsHash, salt_length == rsa.PSSSaltLengthAuto:
+		salt_length = hash.Size()
+	case salt_length < 0:
+		return nil, fmt.Errorf("csc: invalid salt length %d", salt_length)
+	}
+
+	identifier, err := algorithm.PSSAlgorithmIdentifier(hash, salt_length)
+	if err != nil {
+		return nil, fmt.Errorf("csc: %w", err)
+	}
+	return identifier.Parameters.FullBytes, nil
+}
+
+// ecdsaSignature returns the signature ASN.1 encoded, services return either
+// the ASN.1 encoding or r || s.
+func ecdsaSignature(public_key *ecdsa.PublicKey, signature []byte) ([]byte, error) {
+	var parsed struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(signature, &parsed); err == nil && len(rest) == 0 {
+		return signature, nil
+	}
+
+	size := (public_key.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*size {
+		return nil, errors.New("csc: invalid ECDSA signature")
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+}
@@ -7,6 +7,8 @@ require (
 	github.com/digitorus/pkcs7 v0.0.0-20230818184609-3a137a874352
 	github.com/digitorus/timestamp v0.0.0-20231217203849-220c5c2851b7
 	github.com/mattetti/filebuffer v1.0.1
+	github.com/miekg/pkcs11 v1.1.2
 	golang.org/x/crypto v0.46.0
 	golang.org/x/text v0.32.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
@@ -0,0 +1,139 @@
+// Package algorithm contains the digest algorithm identifiers and the
+// RSASSA-PSS parameters shared by the sign, verify and csc packages.
+package algorithm
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	// RFC 4055, 3.1
+	OIDRSASSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	OIDMGF1      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+)
+
+// HashOIDs are the object identifiers of the supported digest algorithms.
+var HashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   {1, 3, 14, 3, 2, 26},
+	crypto.SHA256: {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: {2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+// HashFromOID returns the digest algorithm of the object identifier, zero
+// when it is not supported.
+func HashFromOID(target asn1.ObjectIdentifier) crypto.Hash {
+	for hash, oid := range HashOIDs {
+		if oid.Equal(target) {
+			return hash
+		}
+	}
+	return crypto.Hash(0)
+}
+
+// OIDFromHash returns the object identifier of the digest algorithm, nil when
+// it is not supported.
+func OIDFromHash(target crypto.Hash) asn1.ObjectIdentifier {
+	return HashOIDs[target]
+}
+
+// PSSParameters is RSASSA-PSS-params (RFC 4055, 3.1), trailerFieldBC is the
+// only trailer field.
+type PSSParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	SaltLength   int                      `asn1:"optional,explicit,tag:2,default:20"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+// PSSAlgorithmIdentifier returns id-RSASSA-PSS with the hash used for the
+// message digest and MGF1 and the salt length.
+func PSSAlgorithmIdentifier(hash crypto.Hash, salt_length int) (pkix.AlgorithmIdentifier, error) {
+	oid := OIDFromHash(hash)
+	if oid == nil {
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported digest algorithm %s for RSASSA-PSS", hash)
+	}
+	if salt_length < 0 {
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("invalid RSASSA-PSS salt length %d", salt_length)
+	}
+
+	hash_algorithm := pkix.AlgorithmIdentifier{
+		Algorithm:  oid,
+		Parameters: asn1.NullRawValue,
+	}
+	mgf_parameters, err := asn1.Marshal(hash_algorithm)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	parameters, err := asn1.Marshal(PSSParameters{
+		Hash: hash_algorithm,
+		MGF: pkix.AlgorithmIdentifier{
+			Algorithm:  OIDMGF1,
+			Parameters: asn1.RawValue{FullBytes: mgf_parameters},
+		},
+		SaltLength:   salt_length,
+		TrailerField: 1,
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  OIDRSASSAPSS,
+		Parameters: asn1.RawValue{FullBytes: parameters},
+	}, nil
+}
+
+// ParsePSSParameters returns the hash and salt length of RSASSA-PSS
+// parameters, only MGF1 with the same hash as the message digest is
+// supported.
+func ParsePSSParameters(algorithm pkix.AlgorithmIdentifier) (crypto.Hash, int, error) {
+	// The defaults are SHA-1 with a 20 byte salt.
+	parameters := PSSParameters{SaltLength: 20, TrailerField: 1}
+	if len(algorithm.Parameters.FullBytes) > 0 {
+		rest, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &parameters)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid RSASSA-PSS parameters: %w", err)
+		}
+		if len(rest) > 0 {
+			return 0, 0, errors.New("invalid RSASSA-PSS parameters: trailing data")
+		}
+	}
+
+	hash := crypto.SHA1
+	if len(parameters.Hash.Algorithm) > 0 {
+		hash = HashFromOID(parameters.Hash.Algorithm)
+		if hash == 0 {
+			return 0, 0, fmt.Errorf("unsupported RSASSA-PSS hash algorithm %s", parameters.Hash.Algorithm)
+		}
+	}
+
+	mgf_hash := crypto.SHA1
+	if len(parameters.MGF.Algorithm) > 0 {
+		if !parameters.MGF.Algorithm.Equal(OIDMGF1) {
+			return 0, 0, fmt.Errorf("unsupported RSASSA-PSS mask generation function %s", parameters.MGF.Algorithm)
+		}
+		var mgf_algorithm pkix.AlgorithmIdentifier
+		if _, err := asn1.Unmarshal(parameters.MGF.Parameters.FullBytes, &mgf_algorithm); err != nil {
+			return 0, 0, fmt.Errorf("invalid RSASSA-PSS mask generation parameters: %w", err)
+		}
+		mgf_hash = HashFromOID(mgf_algorithm.Algorithm)
+	}
+	if mgf_hash != hash {
+		return 0, 0, errors.New("RSASSA-PSS mask generation hash differs from the message hash")
+	}
+
+	if parameters.TrailerField != 1 {
+		return 0, 0, fmt.Errorf("unsupported RSASSA-PSS trailer field %d", parameters.TrailerField)
+	}
+	if parameters.SaltLength < 0 {
+		return 0, 0, fmt.Errorf("invalid RSASSA-PSS salt length %d", parameters.SaltLength)
+	}
+
+	return hash, parameters.SaltLength, nil
+}
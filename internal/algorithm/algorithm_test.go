@@ -0,0 +1,65 @@
+package algorithm
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPSSParameters(t *testing.T) {
+	identifier, err := PSSAlgorithmIdentifier(crypto.SHA384, crypto.SHA384.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 4055 encoding of SHA-384 with MGF1-SHA-384 and a 48 byte salt.
+	expected := "3034a00f300d06096086480165030402020500a11c301a06092a864886f70d010108300d06096086480165030402020500a203020130"
+	if got := hex.EncodeToString(identifier.Parameters.FullBytes); got != expected {
+		t.Errorf("unexpected parameters\n got: %s\nwant: %s", got, expected)
+	}
+
+	hash, salt_length, err := ParsePSSParameters(identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != crypto.SHA384 || salt_length != 48 {
+		t.Errorf("expected SHA-384 with a 48 byte salt, got %s with %d", hash, salt_length)
+	}
+
+	// Absent parameters default to SHA-1 with a 20 byte salt.
+	hash, salt_length, err = ParsePSSParameters(pkix.AlgorithmIdentifier{Algorithm: OIDRSASSAPSS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != crypto.SHA1 || salt_length != 20 {
+		t.Errorf("expected SHA-1 with a 20 byte salt, got %s with %d", hash, salt_length)
+	}
+
+	// SHA-256 without a mask generation function would use MGF1-SHA-1.
+	parameters, _ := asn1.Marshal(PSSParameters{
+		Hash:         pkix.AlgorithmIdentifier{Algorithm: HashOIDs[crypto.SHA256], Parameters: asn1.NullRawValue},
+		SaltLength:   32,
+		TrailerField: 1,
+	})
+	if _, _, err := ParsePSSParameters(pkix.AlgorithmIdentifier{Algorithm: OIDRSASSAPSS, Parameters: asn1.RawValue{FullBytes: parameters}}); err == nil {
+		t.Error("expected an error for a different mask generation hash")
+	}
+
+	// The mask generation hash must match the message hash.
+	mgf, _ := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: HashOIDs[crypto.SHA1], Parameters: asn1.NullRawValue})
+	parameters, _ = asn1.Marshal(PSSParameters{
+		Hash:         pkix.AlgorithmIdentifier{Algorithm: HashOIDs[crypto.SHA256], Parameters: asn1.NullRawValue},
+		MGF:          pkix.AlgorithmIdentifier{Algorithm: OIDMGF1, Parameters: asn1.RawValue{FullBytes: mgf}},
+		SaltLength:   32,
+		TrailerField: 1,
+	})
+	if _, _, err := ParsePSSParameters(pkix.AlgorithmIdentifier{Algorithm: OIDRSASSAPSS, Parameters: asn1.RawValue{FullBytes: parameters}}); err == nil {
+		t.Error("expected an error for a different mask generation hash")
+	}
+
+	if _, err := PSSAlgorithmIdentifier(crypto.MD5, 16); err == nil {
+		t.Error("expected an error for an unsupported digest algorithm")
+	}
+}
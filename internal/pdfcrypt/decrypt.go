@@ -0,0 +1,353 @@
+package pdfcrypt
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rc4"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// decryptedReaderAt presents an encrypted document to the PDF reader as if it
+// wasn't encrypted. The objects of the document are scanned once and their
+// strings and streams are decrypted at their original offsets: the decrypted
+// data is never longer than the encrypted data.
+type decryptedReaderAt struct {
+	io.ReaderAt
+	handler *SecurityHandler
+
+	patches []decryptedPatch  // sorted by offset
+	streams []decryptedStream // sorted by offset
+
+	// rc4 continues the key stream of the last RC4 stream that was read, so
+	// a stream that is read sequentially is decrypted once.
+	rc4_mutex    sync.Mutex
+	rc4_stream   int64 // offset of the stream, -1 for none
+	rc4_position int64 // in the stream
+	rc4_cipher   *rc4.Cipher
+}
+
+// decryptedPatch replaces the bytes of a string or a stream length.
+type decryptedPatch struct {
+	offset int64
+	data   []byte
+}
+
+// decryptedStream is stream data that is decrypted when it is read.
+type decryptedStream struct {
+	offset int64 // of the encrypted data
+	size   int64 // of the decrypted data
+	key    []byte
+	method string
+}
+
+func newDecryptedReaderAt(input io.ReaderAt, size int64, handler *SecurityHandler, encrypt_id uint32) (*decryptedReaderAt, error) {
+	r := &decryptedReaderAt{
+		ReaderAt:   input,
+		handler:    handler,
+		rc4_stream: -1,
+	}
+
+	scanner := &objectScanner{input: input, size: size}
+	scanner.seek(0)
+
+	// Stream lengths are decrypted when the length object is known.
+	integers := make(map[uint32]scanToken)
+	lengths := make(map[uint32]int64)
+
+	var previous [2]scanToken
+	for {
+		token, err := scanner.readToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if token.kind != tokenKeyword || token.value != "obj" || !previous[0].isInteger() || !previous[1].isInteger() {
+			previous[0], previous[1] = previous[1], token
+			continue
+		}
+		object_id, _ := strconv.ParseUint(previous[0].value, 10, 32)
+		generation, _ := strconv.ParseUint(previous[1].value, 10, 16)
+		previous = [2]scanToken{}
+
+		object, err := scanner.readObject()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if object.value.kind == valueScalar && object.value.token.isInteger() {
+			integers[uint32(object_id)] = object.value.token
+		}
+
+		if uint32(object_id) == encrypt_id {
+			continue
+		}
+
+		length_id, err := r.addObject(object, uint32(object_id), uint16(generation))
+		if err != nil {
+			return nil, err
+		}
+		if length_id != 0 {
+			lengths[length_id] = r.streams[len(r.streams)-1].size
+		}
+	}
+
+	for object_id, size := range lengths {
+		if token, ok := integers[object_id]; ok {
+			r.addLength(token, size)
+		}
+	}
+
+	slices.SortFunc(r.patches, func(a, b decryptedPatch) int { return cmp.Compare(a.offset, b.offset) })
+	slices.SortFunc(r.streams, func(a, b decryptedStream) int { return cmp.Compare(a.offset, b.offset) })
+
+	return r, nil
+}
+
+// addObject adds the decrypted strings and stream of an object, it returns the
+// object of the stream length when the length has to be decrypted later.
+func (r *decryptedReaderAt) addObject(object *scannedObject, object_id uint32, generation uint16) (uint32, error) {
+	dict := object.value
+	if dict.key("Type").name() == "XRef" {
+		// Cross-reference streams aren't encrypted.
+		return 0, nil
+	}
+
+	// The signature value isn't encrypted.
+	var contents *scanValue
+	if dict.key("ByteRange") != nil {
+		contents = dict.key("Contents")
+	}
+
+	if r.handler.string_method != cryptIdentity {
+		if err := r.addStrings(dict, contents, object_id, generation); err != nil {
+			return 0, err
+		}
+	}
+
+	if object.stream_offset < 0 || r.handler.stream_method == cryptIdentity {
+		return 0, nil
+	}
+	if dict.key("Type").name() == "Metadata" && !r.handler.encrypt_metadata {
+		return 0, nil
+	}
+	if filter := dict.key("Filter"); filter.name() == "Crypt" || slices.ContainsFunc(filter.values(), func(v *scanValue) bool { return v.name() == "Crypt" }) {
+		// Streams with their own crypt filter are left to the reader.
+		return 0, nil
+	}
+
+	stream := decryptedStream{
+		offset: object.stream_offset,
+		size:   object.stream_length,
+		key:    r.handler.objectKey(object_id, generation, r.handler.stream_method),
+		method: r.handler.stream_method,
+	}
+
+	if stream.method == cryptAESV2 || stream.method == cryptAESV3 {
+		// The padding of the last block gives the size of the decrypted data.
+		if stream.size < 2*aes.BlockSize || stream.size%aes.BlockSize != 0 {
+			return 0, nil
+		}
+		last := make([]byte, 2*aes.BlockSize)
+		if _, err := r.ReaderAt.ReadAt(last, stream.offset+stream.size-int64(len(last))); err != nil && err != io.EOF {
+			return 0, err
+		}
+		block, _ := aes.NewCipher(stream.key)
+		cipher.NewCBCDecrypter(block, last[:aes.BlockSize]).CryptBlocks(last[aes.BlockSize:], last[aes.BlockSize:])
+
+		padding := int64(last[len(last)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return 0, nil
+		}
+		stream.size -= aes.BlockSize + padding
+	}
+
+	r.streams = append(r.streams, stream)
+
+	// The reader reads the stream length, it is replaced by the length of the
+	// decrypted data.
+	length := dict.key("Length")
+	switch {
+	case length == nil:
+	case length.kind == valueReference:
+		return length.object_id, nil
+	case length.token.isInteger():
+		r.addLength(length.token, stream.size)
+	}
+
+	return 0, nil
+}
+
+// addLength replaces a stream length, padded to the width of the encrypted
+// length.
+func (r *decryptedReaderAt) addLength(token scanToken, size int64) {
+	length := strconv.FormatInt(size, 10)
+	width := int(token.end - token.start)
+	if len(length) > width {
+		return
+	}
+	r.patches = append(r.patches, decryptedPatch{offset: token.start, data: []byte(length + strings.Repeat(" ", width-len(length)))})
+}
+
+// addStrings adds the decrypted strings of a value, except skip.
+func (r *decryptedReaderAt) addStrings(value *scanValue, skip *scanValue, object_id uint32, generation uint16) error {
+	if value == nil || value == skip {
+		return nil
+	}
+
+	if value.kind != valueString {
+		for _, v := range value.children {
+			if err := r.addStrings(v, skip, object_id, generation); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	decrypted, err := r.handler.decrypt(object_id, generation, r.handler.string_method, []byte(value.token.value))
+	if err != nil {
+		// Strings that aren't encrypted, such as empty strings written by
+		// some producers, are left as is.
+		return nil
+	}
+
+	data, ok := encodeDecryptedString(decrypted, int(value.token.end-value.token.start))
+	if !ok {
+		return &UnsupportedEncryptionError{Reason: fmt.Sprintf("decrypted string of object %d is longer than the encrypted string", object_id)}
+	}
+	r.patches = append(r.patches, decryptedPatch{offset: value.token.start, data: data})
+
+	return nil
+}
+
+// encodeDecryptedString encodes a decrypted string as literal string of width
+// bytes, padded with spaces. The literal string is never longer than the
+// hexadecimal string.
+func encodeDecryptedString(data []byte, width int) ([]byte, bool) {
+	// Balanced parentheses don't have to be escaped.
+	escape := make([]bool, len(data))
+	var open []int
+	for i, c := range data {
+		switch c {
+		case '\\':
+			escape[i] = true
+		case '(':
+			open = append(open, i)
+		case ')':
+			if len(open) == 0 {
+				escape[i] = true
+			} else {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	for _, i := range open {
+		escape[i] = true
+	}
+
+	var encoded bytes.Buffer
+	encoded.WriteByte('(')
+	for i, c := range data {
+		if escape[i] {
+			encoded.WriteByte('\\')
+		}
+		encoded.WriteByte(c)
+	}
+	encoded.WriteByte(')')
+
+	if encoded.Len() > width {
+		return nil, false
+	}
+
+	encoded.WriteString(strings.Repeat(" ", width-encoded.Len()))
+	return encoded.Bytes(), true
+}
+
+func (r *decryptedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ReaderAt.ReadAt(p, off)
+	end := off + int64(n)
+
+	i := sort.Search(len(r.patches), func(i int) bool {
+		return r.patches[i].offset+int64(len(r.patches[i].data)) > off
+	})
+	for ; i < len(r.patches) && r.patches[i].offset < end; i++ {
+		patch := r.patches[i]
+		from := max(off, patch.offset)
+		to := min(end, patch.offset+int64(len(patch.data)))
+		copy(p[from-off:to-off], patch.data[from-patch.offset:])
+	}
+
+	i = sort.Search(len(r.streams), func(i int) bool {
+		return r.streams[i].offset+r.streams[i].size > off
+	})
+	for ; i < len(r.streams) && r.streams[i].offset < end; i++ {
+		stream := r.streams[i]
+		from := max(off, stream.offset)
+		to := min(end, stream.offset+stream.size)
+		if from >= to {
+			continue
+		}
+		if err := r.decryptStream(stream, p[from-off:to-off], from-stream.offset); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, err
+}
+
+// decryptStream decrypts the stream data at position into p, which holds the
+// encrypted data. AES blocks are decrypted with the previous block, the data
+// starts with the initialization vector.
+func (r *decryptedReaderAt) decryptStream(stream decryptedStream, p []byte, position int64) error {
+	switch stream.method {
+	case cryptAESV2, cryptAESV3:
+		first := position / aes.BlockSize
+		last := (position + int64(len(p)) - 1) / aes.BlockSize
+
+		encrypted := make([]byte, (last-first+2)*aes.BlockSize)
+		if _, err := r.ReaderAt.ReadAt(encrypted, stream.offset+first*aes.BlockSize); err != nil && err != io.EOF {
+			return err
+		}
+
+		block, _ := aes.NewCipher(stream.key)
+		decrypted := make([]byte, len(encrypted)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, encrypted[:aes.BlockSize]).CryptBlocks(decrypted, encrypted[aes.BlockSize:])
+		copy(p, decrypted[position-first*aes.BlockSize:])
+	default:
+		r.rc4_mutex.Lock()
+		defer r.rc4_mutex.Unlock()
+
+		// The key stream starts again at the start of the stream when an
+		// earlier position or another stream is read.
+		if r.rc4_stream != stream.offset || r.rc4_position > position {
+			r.rc4_cipher, _ = rc4.NewCipher(stream.key)
+			r.rc4_stream = stream.offset
+			r.rc4_position = 0
+		}
+
+		skip := make([]byte, min(position-r.rc4_position, 32*1024))
+		for r.rc4_position < position {
+			n := min(int64(len(skip)), position-r.rc4_position)
+			r.rc4_cipher.XORKeyStream(skip[:n], skip[:n])
+			r.rc4_position += n
+		}
+
+		r.rc4_cipher.XORKeyStream(p, p)
+		r.rc4_position += int64(len(p))
+	}
+
+	return nil
+}
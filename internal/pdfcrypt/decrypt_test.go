@@ -0,0 +1,85 @@
+package pdfcrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecryptedString(t *testing.T) {
+	tests := []struct {
+		data     string
+		width    int
+		expected string
+	}{
+		{"John Doe", 12, "(John Doe)  "},
+		{"(a) b)", 10, "((a) b\\)) "},
+		{"a\\b(", 8, "(a\\\\b\\()"},
+		{"((((", 9, ""},
+	}
+
+	for _, tt := range tests {
+		encoded, ok := encodeDecryptedString([]byte(tt.data), tt.width)
+		if ok != (tt.expected != "") || string(encoded) != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.data, tt.expected, encoded)
+		}
+	}
+}
+
+func TestDecryptedReaderAtRC4(t *testing.T) {
+	data := readFixture(t, "rc4-128-cf")
+	size := int64(len(data))
+
+	encrypt, id, err := ReadEncryptionDictionary(bytes.NewReader(data), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewSecurityHandler(encrypt, id, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	masked, err := newMaskedReaderAt(bytes.NewReader(data), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt_ptr := encrypt.GetPtr()
+	r, err := newDecryptedReaderAt(masked, size, handler, encrypt_ptr.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The content stream of the fixture is 256KB before compression.
+	var stream decryptedStream
+	for _, s := range r.streams {
+		if s.size > stream.size {
+			stream = s
+		}
+	}
+	if stream.method != cryptRC4 || stream.size < 4096 {
+		t.Fatalf("expected a large RC4 stream, got %d bytes of %s", stream.size, stream.method)
+	}
+	expected := rc4Crypt(stream.key, data[stream.offset:stream.offset+stream.size])
+
+	read := func(off int64, n int64) []byte {
+		p := make([]byte, n)
+		if _, err := r.ReadAt(p, stream.offset+off); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// Sequential reads continue the key stream.
+	var sequential []byte
+	for off := int64(0); off < stream.size; off += 1000 {
+		sequential = append(sequential, read(off, min(1000, stream.size-off))...)
+	}
+	if !bytes.Equal(sequential, expected) {
+		t.Error("sequential reads don't match the decrypted stream")
+	}
+
+	// Backward reads and skipped data restart the key stream.
+	for _, off := range []int64{stream.size - 100, 10, 0, 2000, 1500, stream.size / 2} {
+		if !bytes.Equal(read(off, 100), expected[off:off+100]) {
+			t.Errorf("read at %d doesn't match the decrypted stream", off)
+		}
+	}
+}
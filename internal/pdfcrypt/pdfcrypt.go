@@ -0,0 +1,563 @@
+// Package pdfcrypt implements the standard security handler of encrypted PDF
+// documents (ISO 32000-2, 7.6.4) for the sign package: it opens encrypted
+// documents for the PDF reader and encrypts the objects of the incremental
+// update.
+package pdfcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/digitorus/pdf"
+)
+
+// ErrInvalidPassword is returned when the password doesn't open an encrypted
+// document.
+var ErrInvalidPassword = errors.New("encrypted PDF: invalid password")
+
+// UnsupportedEncryptionError is returned for encrypted documents that can't be
+// signed, such as documents with an unknown security handler.
+type UnsupportedEncryptionError struct {
+	Reason string
+}
+
+func (e *UnsupportedEncryptionError) Error() string {
+	return "unsupported PDF: " + e.Reason
+}
+
+// Crypt filter methods (Table 25).
+const (
+	cryptIdentity = "Identity"
+	cryptRC4      = "V2"
+	cryptAESV2    = "AESV2"
+	cryptAESV3    = "AESV3"
+)
+
+// maskedEncryptKey replaces /Encrypt in the trailer to read the encryption
+// dictionary without decrypting its strings, it has the same length.
+const maskedEncryptKey = "EncrypX"
+
+// passwordPadding is used to pad passwords for revision 2 to 4 (Algorithm 2).
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// SecurityHandler implements the standard security handler (ISO 32000-2,
+// 7.6.4) to decrypt the document and to encrypt the strings and streams of
+// the incremental update with the file encryption key of the document.
+type SecurityHandler struct {
+	// ObjectID and Generation of the encryption dictionary, zero for a
+	// direct dictionary in the trailer. They are set by the caller.
+	ObjectID   uint32
+	Generation uint16
+
+	revision         int
+	key              []byte
+	string_method    string
+	stream_method    string
+	encrypt_metadata bool
+
+	// userPassword opens the document for revision 2 to 4 when the document
+	// was opened with the owner password.
+	userPassword string
+}
+
+// NewReader opens a PDF document, encrypted documents are opened with
+// password, which may be the user or the owner password.
+//
+// The PDF reader only decrypts documents encrypted with 128-bit RC4 without
+// crypt filters, it derives wrong object keys for shorter keys and can't
+// decrypt AES strings. The strings and streams of all other documents are
+// decrypted for the reader by decryptedReaderAt.
+func NewReader(input io.ReaderAt, size int64, password string) (*pdf.Reader, error) {
+	encrypt, id, err := ReadEncryptionDictionary(input, size)
+	if err != nil {
+		return nil, err
+	}
+	if encrypt.IsNull() {
+		return pdf.NewReader(input, size)
+	}
+
+	handler, err := NewSecurityHandler(encrypt, id, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypt.Key("V").Int64() >= 4 || len(handler.key) < 16 {
+		masked, err := newMaskedReaderAt(input, size)
+		if err != nil {
+			return nil, err
+		}
+
+		encrypt_ptr := encrypt.GetPtr()
+		decrypted, err := newDecryptedReaderAt(masked, size, handler, encrypt_ptr.GetID())
+		if err != nil {
+			return nil, err
+		}
+
+		return pdf.NewReader(decrypted, size)
+	}
+
+	passwords := []string{handler.userPassword}
+	return pdf.NewReaderEncrypted(input, size, func() string {
+		if len(passwords) == 0 {
+			return ""
+		}
+		password := passwords[0]
+		passwords = passwords[1:]
+		return password
+	})
+}
+
+// ReadEncryptionDictionary returns the encryption dictionary and the first
+// file identifier of the document. The strings of the encryption dictionary
+// aren't encrypted, the document is read with /Encrypt masked in the trailer
+// so they're not decrypted by the reader.
+func ReadEncryptionDictionary(input io.ReaderAt, size int64) (pdf.Value, []byte, error) {
+	masked, err := newMaskedReaderAt(input, size)
+	if err != nil {
+		return pdf.Value{}, nil, err
+	}
+
+	rdr, err := pdf.NewReader(masked, size)
+	if err != nil {
+		return pdf.Value{}, nil, err
+	}
+
+	encrypt := rdr.Trailer().Key(maskedEncryptKey)
+	if encrypt.IsNull() {
+		return pdf.Value{}, nil, nil
+	}
+
+	return encrypt, []byte(rdr.Trailer().Key("ID").Index(0).RawString()), nil
+}
+
+// maskedReaderAt masks the /Encrypt entries of the last trailer.
+type maskedReaderAt struct {
+	io.ReaderAt
+	positions []int64
+}
+
+var startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+
+func newMaskedReaderAt(input io.ReaderAt, size int64) (*maskedReaderAt, error) {
+	tail_size := min(size, 1024)
+	tail := make([]byte, tail_size)
+	if _, err := input.ReadAt(tail, size-tail_size); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	matches := startxrefPattern.FindAllSubmatch(tail, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("malformed PDF file: missing startxref")
+	}
+	startxref, err := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+	if err != nil || startxref < 0 || startxref >= size {
+		return nil, fmt.Errorf("malformed PDF file: invalid startxref")
+	}
+
+	trailer := make([]byte, size-startxref)
+	if _, err := input.ReadAt(trailer, startxref); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// The trailer of a cross-reference stream is the stream dictionary.
+	if i := bytes.Index(trailer, []byte("stream")); i >= 0 {
+		trailer = trailer[:i]
+	}
+
+	masked := &maskedReaderAt{ReaderAt: input}
+	for offset := 0; ; {
+		i := bytes.Index(trailer[offset:], []byte("/Encrypt"))
+		if i < 0 {
+			break
+		}
+		masked.positions = append(masked.positions, startxref+int64(offset+i)+1)
+		offset += i + 1
+	}
+
+	return masked, nil
+}
+
+func (r *maskedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.ReaderAt.ReadAt(p, off)
+	for _, position := range r.positions {
+		for i := 0; i < len(maskedEncryptKey); i++ {
+			if j := position + int64(i) - off; j >= 0 && j < int64(n) {
+				p[j] = maskedEncryptKey[i]
+			}
+		}
+	}
+	return n, err
+}
+
+// NewSecurityHandler authenticates the password as user or owner password
+// and computes the file encryption key.
+func NewSecurityHandler(encrypt pdf.Value, id []byte, password string) (*SecurityHandler, error) {
+	if encrypt.Key("Filter").Name() != "Standard" {
+		return nil, &UnsupportedEncryptionError{Reason: fmt.Sprintf("encryption filter %s", encrypt.Key("Filter").Name())}
+	}
+
+	handler := &SecurityHandler{
+		revision:         int(encrypt.Key("R").Int64()),
+		encrypt_metadata: encrypt.Key("EncryptMetadata").Kind() != pdf.Bool || encrypt.Key("EncryptMetadata").Bool(),
+	}
+
+	switch v := encrypt.Key("V").Int64(); v {
+	case 1, 2:
+		handler.string_method = cryptRC4
+		handler.stream_method = cryptRC4
+	case 4, 5:
+		handler.string_method = cryptFilterMethod(encrypt, encrypt.Key("StrF").Name())
+		handler.stream_method = cryptFilterMethod(encrypt, encrypt.Key("StmF").Name())
+	default:
+		return nil, &UnsupportedEncryptionError{Reason: fmt.Sprintf("encryption version V=%d", v)}
+	}
+
+	for _, method := range []string{handler.string_method, handler.stream_method} {
+		switch method {
+		case cryptIdentity, cryptRC4, cryptAESV2, cryptAESV3:
+		default:
+			return nil, &UnsupportedEncryptionError{Reason: fmt.Sprintf("crypt filter method %s", method)}
+		}
+	}
+
+	var err error
+	switch handler.revision {
+	case 2, 3, 4:
+		err = handler.authenticateRC4(encrypt, id, []byte(password))
+	case 5, 6:
+		err = handler.authenticateAES256(encrypt, []byte(password))
+	default:
+		return nil, &UnsupportedEncryptionError{Reason: fmt.Sprintf("encryption revision R=%d", handler.revision)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return handler, nil
+}
+
+// cryptFilterMethod returns the method of a crypt filter, the standard
+// security handler uses the Identity filter when no filter is specified.
+func cryptFilterMethod(encrypt pdf.Value, filter string) string {
+	if filter == "" || filter == cryptIdentity {
+		return cryptIdentity
+	}
+
+	method := encrypt.Key("CF").Key(filter).Key("CFM").Name()
+	if method == "" || method == "None" {
+		return cryptIdentity
+	}
+	return method
+}
+
+// authenticateRC4 computes the file encryption key for revision 2 to 4
+// (Algorithm 2), the password is checked as user password (Algorithm 6) and
+// as owner password (Algorithm 7).
+func (h *SecurityHandler) authenticateRC4(encrypt pdf.Value, id []byte, password []byte) error {
+	o := []byte(encrypt.Key("O").RawString())
+	u := []byte(encrypt.Key("U").RawString())
+	if len(o) < 32 || len(u) < 32 {
+		return fmt.Errorf("malformed PDF: missing O or U encryption parameters")
+	}
+
+	length := 40
+	if h.revision >= 3 {
+		if l := encrypt.Key("Length").Int64(); l != 0 {
+			length = int(l)
+		}
+	}
+	if length%8 != 0 || length < 40 || length > 128 {
+		return fmt.Errorf("malformed PDF: %d-bit encryption key", length)
+	}
+
+	permissions := uint32(encrypt.Key("P").Int64())
+
+	fileKey := func(user_password []byte) []byte {
+		sum := md5.New()
+		sum.Write(padPassword(user_password))
+		sum.Write(o[:32])
+		sum.Write([]byte{byte(permissions), byte(permissions >> 8), byte(permissions >> 16), byte(permissions >> 24)})
+		sum.Write(id)
+		if h.revision >= 4 && !h.encrypt_metadata {
+			sum.Write([]byte{0xff, 0xff, 0xff, 0xff})
+		}
+		key := sum.Sum(nil)
+		if h.revision >= 3 {
+			for i := 0; i < 50; i++ {
+				next := md5.Sum(key[:length/8])
+				key = next[:]
+			}
+		}
+		return key[:length/8]
+	}
+
+	checkUserPassword := func(user_password []byte) []byte {
+		key := fileKey(user_password)
+		if h.revision == 2 {
+			computed := rc4Crypt(key, passwordPadding)
+			if bytes.Equal(computed, u[:32]) {
+				return key
+			}
+			return nil
+		}
+
+		sum := md5.New()
+		sum.Write(passwordPadding)
+		sum.Write(id)
+		computed := rc4Iterate(key, sum.Sum(nil), false)
+		if bytes.Equal(computed, u[:16]) {
+			return key
+		}
+		return nil
+	}
+
+	if key := checkUserPassword(password); key != nil {
+		h.key = key
+		h.userPassword = string(password)
+		return nil
+	}
+
+	// The owner password decrypts O to the padded user password
+	// (Algorithm 3).
+	owner_hash := md5.Sum(padPassword(password))
+	owner_key := owner_hash[:]
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			next := md5.Sum(owner_key)
+			owner_key = next[:]
+		}
+	}
+	owner_key = owner_key[:length/8]
+
+	var user_password []byte
+	if h.revision == 2 {
+		user_password = rc4Crypt(owner_key, o[:32])
+	} else {
+		user_password = rc4Iterate(owner_key, o[:32], true)
+	}
+
+	if key := checkUserPassword(user_password); key != nil {
+		h.key = key
+		h.userPassword = string(user_password)
+		return nil
+	}
+
+	return ErrInvalidPassword
+}
+
+// authenticateAES256 computes the file encryption key for revision 5 and 6
+// (Algorithm 2.A).
+func (h *SecurityHandler) authenticateAES256(encrypt pdf.Value, password []byte) error {
+	o := []byte(encrypt.Key("O").RawString())
+	u := []byte(encrypt.Key("U").RawString())
+	oe := []byte(encrypt.Key("OE").RawString())
+	ue := []byte(encrypt.Key("UE").RawString())
+	if len(o) < 48 || len(u) < 48 || len(oe) != 32 || len(ue) != 32 {
+		return fmt.Errorf("malformed PDF: missing O, U, OE or UE encryption parameters")
+	}
+
+	// Passwords are UTF-8 encoded and truncated to 127 bytes.
+	if len(password) > 127 {
+		password = password[:127]
+	}
+
+	var encrypted_key []byte
+	var intermediate []byte
+	switch {
+	case bytes.Equal(h.hash(password, o[32:40], u[:48]), o[:32]):
+		intermediate = h.hash(password, o[40:48], u[:48])
+		encrypted_key = oe
+	case bytes.Equal(h.hash(password, u[32:40], nil), u[:32]):
+		intermediate = h.hash(password, u[40:48], nil)
+		encrypted_key = ue
+	default:
+		return ErrInvalidPassword
+	}
+
+	block, err := aes.NewCipher(intermediate)
+	if err != nil {
+		return err
+	}
+
+	h.key = make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(h.key, encrypted_key)
+	h.userPassword = string(password)
+
+	return nil
+}
+
+// hash computes the password hash for revision 5 and 6 (Algorithm 2.B).
+func (h *SecurityHandler) hash(password, salt, user_key []byte) []byte {
+	sum := sha256.New()
+	sum.Write(password)
+	sum.Write(salt)
+	sum.Write(user_key)
+	k := sum.Sum(nil)
+
+	if h.revision == 5 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		k1 := bytes.Repeat(append(append(append([]byte{}, password...), k...), user_key...), 64)
+
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		var remainder int
+		for _, b := range e[:16] {
+			remainder += int(b)
+		}
+
+		var next hash.Hash
+		switch remainder % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		case 2:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			break
+		}
+	}
+
+	return k[:32]
+}
+
+// objectKey returns the key used to encrypt the strings and streams of an
+// object (Algorithm 1), AES-256 uses the file encryption key.
+func (h *SecurityHandler) objectKey(object_id uint32, generation uint16, method string) []byte {
+	if method == cryptAESV3 {
+		return h.key
+	}
+
+	sum := md5.New()
+	sum.Write(h.key)
+	sum.Write([]byte{byte(object_id), byte(object_id >> 8), byte(object_id >> 16), byte(generation), byte(generation >> 8)})
+	if method == cryptAESV2 {
+		sum.Write([]byte("sAlT"))
+	}
+
+	return sum.Sum(nil)[:min(len(h.key)+5, 16)]
+}
+
+// encrypt encrypts the data of an object with one of the supported methods,
+// the method is validated by NewSecurityHandler.
+func (h *SecurityHandler) encrypt(object_id uint32, method string, data []byte) []byte {
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(h.objectKey(object_id, 0, method), data)
+	case cryptAESV2, cryptAESV3:
+		block, _ := aes.NewCipher(h.objectKey(object_id, 0, method))
+
+		// The initialization vector is stored in front of the data, the data
+		// is padded as described in RFC 8018.
+		padding := aes.BlockSize - len(data)%aes.BlockSize
+		encrypted := make([]byte, aes.BlockSize+len(data)+padding)
+		_, _ = rand.Read(encrypted[:aes.BlockSize])
+		copy(encrypted[aes.BlockSize:], data)
+		copy(encrypted[aes.BlockSize+len(data):], bytes.Repeat([]byte{byte(padding)}, padding))
+
+		cipher.NewCBCEncrypter(block, encrypted[:aes.BlockSize]).CryptBlocks(encrypted[aes.BlockSize:], encrypted[aes.BlockSize:])
+		return encrypted
+	default:
+		return data
+	}
+}
+
+// decrypt decrypts the data of an object encrypted with one of the supported
+// methods, see encrypt.
+func (h *SecurityHandler) decrypt(object_id uint32, generation uint16, method string, data []byte) ([]byte, error) {
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(h.objectKey(object_id, generation, method), data), nil
+	case cryptAESV2, cryptAESV3:
+		if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("malformed PDF: invalid AES encrypted data length %d", len(data))
+		}
+
+		block, _ := aes.NewCipher(h.objectKey(object_id, generation, method))
+		decrypted := make([]byte, len(data)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(decrypted, data[aes.BlockSize:])
+
+		padding := int(decrypted[len(decrypted)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, fmt.Errorf("malformed PDF: invalid AES padding")
+		}
+		return decrypted[:len(decrypted)-padding], nil
+	default:
+		return data, nil
+	}
+}
+
+// IsEncrypted reports whether the document is encrypted, the encryption
+// dictionary isn't resolved as the reader would decrypt its strings. The
+// entry is masked for documents decrypted by decryptedReaderAt.
+func IsEncrypted(rdr *pdf.Reader) bool {
+	keys := rdr.Trailer().Keys()
+	return slices.Contains(keys, "Encrypt") || slices.Contains(keys, maskedEncryptKey)
+}
+
+// EncryptString encrypts a string of the object with the string crypt filter.
+func (h *SecurityHandler) EncryptString(object_id uint32, data []byte) []byte {
+	return h.encrypt(object_id, h.string_method, data)
+}
+
+// EncryptStream encrypts the stream data of the object with the stream crypt
+// filter.
+func (h *SecurityHandler) EncryptStream(object_id uint32, data []byte) []byte {
+	return h.encrypt(object_id, h.stream_method, data)
+}
+
+func padPassword(password []byte) []byte {
+	padded := make([]byte, 32)
+	n := copy(padded, password)
+	copy(padded[n:], passwordPadding)
+	return padded
+}
+
+func rc4Crypt(key []byte, data []byte) []byte {
+	c, _ := rc4.NewCipher(key)
+	result := make([]byte, len(data))
+	c.XORKeyStream(result, data)
+	return result
+}
+
+// rc4Iterate encrypts the data 20 times with the key XORed with the round
+// number (Algorithm 5 and 7), reverse undoes the encryption.
+func rc4Iterate(key []byte, data []byte, reverse bool) []byte {
+	round_key := make([]byte, len(key))
+	for i := 0; i <= 19; i++ {
+		round := i
+		if reverse {
+			round = 19 - i
+		}
+		for j := range key {
+			round_key[j] = key[j] ^ byte(round)
+		}
+		data = rc4Crypt(round_key, data)
+	}
+	return data
+}
@@ -0,0 +1,167 @@
+package pdfcrypt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+// The fixtures are encrypted by testfiles/encrypted/generate.py, independently
+// of this package, with the user password "user" and the owner password
+// "owner". aes-256-owner.pdf only has the owner password.
+const fixtureDir = "../../testfiles/encrypted/"
+
+var fixtures = []struct {
+	name          string
+	revision      int
+	key_bytes     int
+	string_method string
+	passwords     []string
+}{
+	{"rc4-40", 2, 5, cryptRC4, []string{"user", "owner"}},
+	{"rc4-128", 3, 16, cryptRC4, []string{"user", "owner"}},
+	{"rc4-128-cf", 4, 16, cryptRC4, []string{"user", "owner"}},
+	{"aes-128", 4, 16, cryptAESV2, []string{"user", "owner"}},
+	{"aes-256", 6, 32, cryptAESV3, []string{"user", "owner"}},
+	{"aes-256-owner", 6, 32, cryptAESV3, []string{"", "owner"}},
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(fixtureDir + name + ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNewSecurityHandler(t *testing.T) {
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			data := readFixture(t, fixture.name)
+
+			encrypt, id, err := ReadEncryptionDictionary(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("failed to read encryption dictionary: %s", err)
+			}
+
+			var key []byte
+			for _, password := range fixture.passwords {
+				handler, err := NewSecurityHandler(encrypt, id, password)
+				if err != nil {
+					t.Fatalf("failed to authenticate %q: %s", password, err)
+				}
+				if handler.revision != fixture.revision || len(handler.key) != fixture.key_bytes || handler.string_method != fixture.string_method {
+					t.Errorf("%q: unexpected revision %d, key length %d or method %s", password, handler.revision, len(handler.key), handler.string_method)
+				}
+
+				// The user and the owner password give the same key.
+				if key != nil && !bytes.Equal(key, handler.key) {
+					t.Errorf("%q: expected file key %x, got %x", password, key, handler.key)
+				}
+				key = handler.key
+			}
+
+			if _, err := NewSecurityHandler(encrypt, id, "wrong"); !errors.Is(err, ErrInvalidPassword) {
+				t.Fatalf("expected ErrInvalidPassword, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	for _, fixture := range fixtures {
+		for _, password := range fixture.passwords {
+			t.Run(fixture.name+"/"+password, func(t *testing.T) {
+				data := readFixture(t, fixture.name)
+
+				rdr, err := NewReader(bytes.NewReader(data), int64(len(data)), password)
+				if err != nil {
+					t.Fatalf("failed to open document: %s", err)
+				}
+				if !IsEncrypted(rdr) {
+					t.Error("expected an encrypted document")
+				}
+
+				info := rdr.Trailer().Key("Info")
+				if title := info.Key("Title").Text(); title != `Encrypted (test) document \ pdfsign` {
+					t.Errorf("unexpected title %q", title)
+				}
+				if producer := info.Key("Producer").Text(); producer != "generate.py" {
+					t.Errorf("unexpected producer %q", producer)
+				}
+
+				root := rdr.Trailer().Key("Root")
+				if lang := root.Key("Lang").Text(); lang != "en-US" {
+					t.Errorf("unexpected language %q", lang)
+				}
+
+				// The pages and the font are in the object stream of the
+				// AES-256 documents.
+				page := root.Key("Pages").Key("Kids").Index(0)
+				if font := page.Key("Resources").Key("Font").Key("F1").Key("BaseFont").Name(); font != "Helvetica" {
+					t.Errorf("unexpected font %q", font)
+				}
+				if modified := page.Key("PieceInfo").Key("pdfsign").Key("LastModified").RawString(); modified != "D:20240101000000Z" {
+					t.Errorf("unexpected page string %q", modified)
+				}
+
+				var content bytes.Buffer
+				if _, err := content.ReadFrom(page.Key("Contents").Reader()); err != nil {
+					t.Fatalf("failed to read content stream: %s", err)
+				}
+				if !bytes.HasPrefix(content.Bytes(), []byte("BT /F1 24 Tf 72 700 Td (Encrypted test document) Tj ET\n")) {
+					t.Errorf("unexpected content stream %q", content.Bytes())
+				}
+			})
+		}
+	}
+}
+
+func TestNewReaderInvalidPassword(t *testing.T) {
+	data := readFixture(t, "aes-128")
+
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data)), "wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+}
+
+// parseDictionary reads a dictionary with the PDF reader.
+func parseDictionary(t *testing.T, dict string) pdf.Value {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.7\n")
+	catalog := buffer.Len()
+	buffer.WriteString("1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	object := buffer.Len()
+	_, _ = fmt.Fprintf(&buffer, "2 0 obj\n%s\nendobj\n", dict)
+	xref := buffer.Len()
+	_, _ = fmt.Fprintf(&buffer, "xref\n0 3\n0000000000 65535 f \n%010d 00000 n \n%010d 00000 n \n", catalog, object)
+	_, _ = fmt.Fprintf(&buffer, "trailer\n<< /Size 3 /Root 1 0 R /Dict 2 0 R >>\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	rdr, err := pdf.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rdr.Trailer().Key("Dict")
+}
+
+func TestNewSecurityHandlerUnsupported(t *testing.T) {
+	encrypt := parseDictionary(t, "<< /Filter /Adobe.PubSec /V 4 /R 4 >>")
+
+	_, err := NewSecurityHandler(encrypt, nil, "")
+	var unsupported *UnsupportedEncryptionError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected UnsupportedEncryptionError, got %v", err)
+	}
+	if unsupported.Reason != "encryption filter Adobe.PubSec" {
+		t.Errorf("unexpected reason %q", unsupported.Reason)
+	}
+}
@@ -0,0 +1,495 @@
+package pdfcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// objectScanner reads the indirect objects of a document in file order, the
+// offsets of the tokens are kept to replace them.
+type objectScanner struct {
+	input  io.ReaderAt
+	size   int64
+	r      *bufio.Reader
+	offset int64 // of the next byte of r
+	tokens []scanToken
+}
+
+const (
+	tokenKeyword = iota // keywords, numbers and delimiters
+	tokenName
+	tokenString
+)
+
+type scanToken struct {
+	kind  int
+	value string // decoded names and strings
+	start int64
+	end   int64
+}
+
+func (t scanToken) isInteger() bool {
+	if t.kind != tokenKeyword || t.value == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(t.value, 10, 64)
+	return err == nil
+}
+
+const (
+	valueScalar = iota
+	valueString
+	valueReference
+	valueDictionary
+	valueArray
+)
+
+// maxScanDepth limits the nesting of dictionaries and arrays.
+const maxScanDepth = 100
+
+type scanValue struct {
+	kind      int
+	token     scanToken // of scalars and strings
+	object_id uint32    // of references
+	keys      []string  // of dictionaries
+	children  []*scanValue
+}
+
+func (v *scanValue) key(key string) *scanValue {
+	if v == nil || v.kind != valueDictionary {
+		return nil
+	}
+	if i := slices.Index(v.keys, key); i >= 0 {
+		return v.children[i]
+	}
+	return nil
+}
+
+func (v *scanValue) name() string {
+	if v == nil || v.token.kind != tokenName {
+		return ""
+	}
+	return v.token.value
+}
+
+func (v *scanValue) values() []*scanValue {
+	if v == nil || v.kind != valueArray {
+		return nil
+	}
+	return v.children
+}
+
+type scannedObject struct {
+	value         *scanValue
+	stream_offset int64 // -1 without stream
+	stream_length int64
+}
+
+func (s *objectScanner) seek(offset int64) {
+	section := io.NewSectionReader(s.input, offset, s.size-offset)
+	if s.r == nil {
+		s.r = bufio.NewReaderSize(section, 64*1024)
+	} else {
+		s.r.Reset(section)
+	}
+	s.offset = offset
+	s.tokens = s.tokens[:0]
+}
+
+func (s *objectScanner) readByte() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err == nil {
+		s.offset++
+	}
+	return c, err
+}
+
+func (s *objectScanner) unreadByte() {
+	if s.r.UnreadByte() == nil {
+		s.offset--
+	}
+}
+
+func (s *objectScanner) unreadToken(token scanToken) {
+	s.tokens = append(s.tokens, token)
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func (s *objectScanner) readToken() (scanToken, error) {
+	if n := len(s.tokens); n > 0 {
+		token := s.tokens[n-1]
+		s.tokens = s.tokens[:n-1]
+		return token, nil
+	}
+
+	var c byte
+	var err error
+	for {
+		if c, err = s.readByte(); err != nil {
+			return scanToken{}, err
+		}
+		if c == '%' {
+			for c != '\r' && c != '\n' {
+				if c, err = s.readByte(); err != nil {
+					return scanToken{}, err
+				}
+			}
+		}
+		if !isWhitespace(c) {
+			break
+		}
+	}
+
+	token := scanToken{kind: tokenKeyword, start: s.offset - 1}
+	switch c {
+	case '(':
+		token.kind = tokenString
+		token.value, err = s.readLiteralString()
+	case '<':
+		if c, err = s.readByte(); err == nil && c == '<' {
+			token.value = "<<"
+		} else {
+			s.unreadByte()
+			token.kind = tokenString
+			token.value, err = s.readHexString()
+		}
+	case '>':
+		if c, err = s.readByte(); err == nil && c == '>' {
+			token.value = ">>"
+		} else {
+			s.unreadByte()
+			token.value = ">"
+		}
+	case '[', ']', '{', '}', ')':
+		token.value = string(c)
+	case '/':
+		token.kind = tokenName
+		token.value, err = s.readRegular()
+		token.value = decodeName(token.value)
+	default:
+		s.unreadByte()
+		token.value, err = s.readRegular()
+	}
+	if err != nil && err != io.EOF {
+		return scanToken{}, err
+	}
+	token.end = s.offset
+
+	return token, nil
+}
+
+// readRegular reads the regular characters of a keyword, number or name.
+func (s *objectScanner) readRegular() (string, error) {
+	var value []byte
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return string(value), err
+		}
+		if isWhitespace(c) || isDelimiter(c) {
+			s.unreadByte()
+			return string(value), nil
+		}
+		value = append(value, c)
+	}
+}
+
+// decodeName decodes the #xx escapes of a name.
+func decodeName(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+
+	var decoded []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := hex.DecodeString(name[i+1 : i+3]); err == nil {
+				decoded = append(decoded, b[0])
+				i += 2
+				continue
+			}
+		}
+		decoded = append(decoded, name[i])
+	}
+	return string(decoded)
+}
+
+func (s *objectScanner) readLiteralString() (string, error) {
+	var value []byte
+	depth := 1
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return string(value), err
+		}
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return string(value), nil
+			}
+		case '\\':
+			if c, err = s.readByte(); err != nil {
+				return string(value), err
+			}
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if c, err = s.readByte(); err == nil && c != '\n' {
+					s.unreadByte()
+				}
+				continue
+			case '\n':
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				x := int(c - '0')
+				for i := 0; i < 2; i++ {
+					if c, err = s.readByte(); err != nil {
+						break
+					}
+					if c < '0' || c > '7' {
+						s.unreadByte()
+						break
+					}
+					x = x*8 + int(c-'0')
+				}
+				c = byte(x)
+			}
+		}
+		value = append(value, c)
+	}
+}
+
+func (s *objectScanner) readHexString() (string, error) {
+	var digits []byte
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return "", err
+		}
+		if c == '>' {
+			break
+		}
+		if bytes.IndexByte([]byte("0123456789abcdefABCDEF"), c) >= 0 {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	value, _ := hex.DecodeString(string(digits))
+	return string(value), nil
+}
+
+// readObject reads the value and stream of an indirect object, the stream
+// data is skipped.
+func (s *objectScanner) readObject() (*scannedObject, error) {
+	value, err := s.readValue(0)
+	if err != nil {
+		return nil, err
+	}
+	object := &scannedObject{value: value, stream_offset: -1}
+
+	token, err := s.readToken()
+	if err != nil {
+		return object, err
+	}
+	if token.kind != tokenKeyword || token.value != "stream" || token.end != s.offset {
+		s.unreadToken(token)
+		return object, nil
+	}
+
+	// The stream keyword is followed by CRLF or LF, as read by the reader.
+	if c, err := s.readByte(); err == nil && c == '\r' {
+		if c, err := s.readByte(); err == nil && c != '\n' {
+			s.unreadByte()
+		}
+	} else if err == nil && c != '\n' {
+		s.unreadByte()
+	}
+	object.stream_offset = s.offset
+
+	length := value.key("Length")
+	if length != nil && length.kind == valueScalar && length.token.isInteger() {
+		object.stream_length, _ = strconv.ParseInt(length.token.value, 10, 64)
+		s.seek(object.stream_offset + object.stream_length)
+		return object, nil
+	}
+
+	// The length is an indirect object, the data ends before the end of line
+	// of the endstream keyword.
+	end, err := s.skipStream()
+	if err != nil {
+		return object, err
+	}
+	object.stream_length = end - object.stream_offset
+	if data, err := s.readAt(end-2, 2); err == nil {
+		switch {
+		case bytes.Equal(data, []byte("\r\n")):
+			object.stream_length -= 2
+		case data[1] == '\n' || data[1] == '\r':
+			object.stream_length--
+		}
+	}
+
+	return object, nil
+}
+
+// skipStream skips to the endstream keyword and returns its offset.
+func (s *objectScanner) skipStream() (int64, error) {
+	keyword := []byte("endstream")
+	matched := 0
+	for {
+		c, err := s.readByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c == keyword[matched]:
+			matched++
+		case c == keyword[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+		if matched == len(keyword) {
+			return s.offset - int64(len(keyword)), nil
+		}
+	}
+}
+
+func (s *objectScanner) readAt(offset int64, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := s.input.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *objectScanner) readValue(depth int) (*scanValue, error) {
+	if depth > maxScanDepth {
+		return nil, fmt.Errorf("malformed PDF: objects nested too deep")
+	}
+
+	token, err := s.readToken()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case token.kind == tokenString:
+		return &scanValue{kind: valueString, token: token}, nil
+	case token.kind == tokenKeyword && token.value == "<<":
+		dict := &scanValue{kind: valueDictionary, token: token}
+		for {
+			key, err := s.readToken()
+			if err != nil {
+				return nil, err
+			}
+			if key.kind == tokenKeyword && key.value == ">>" {
+				return dict, nil
+			}
+			if key.kind != tokenName {
+				if isObjectKeyword(key) {
+					s.unreadToken(key)
+					return dict, nil
+				}
+				continue
+			}
+
+			value, err := s.readValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict.keys = append(dict.keys, key.value)
+			dict.children = append(dict.children, value)
+		}
+	case token.kind == tokenKeyword && token.value == "[":
+		array := &scanValue{kind: valueArray, token: token}
+		for {
+			next, err := s.readToken()
+			if err != nil {
+				return nil, err
+			}
+			if next.kind == tokenKeyword && next.value == "]" {
+				return array, nil
+			}
+			s.unreadToken(next)
+			if isObjectKeyword(next) {
+				return array, nil
+			}
+
+			value, err := s.readValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array.children = append(array.children, value)
+		}
+	case token.isInteger():
+		// An integer followed by a generation and R is a reference.
+		generation, err := s.readToken()
+		if err != nil {
+			return &scanValue{kind: valueScalar, token: token}, nil
+		}
+		if generation.isInteger() {
+			r, err := s.readToken()
+			if err == nil && r.kind == tokenKeyword && r.value == "R" {
+				object_id, _ := strconv.ParseUint(token.value, 10, 32)
+				return &scanValue{kind: valueReference, token: token, object_id: uint32(object_id)}, nil
+			}
+			if err == nil {
+				s.unreadToken(r)
+			}
+		}
+		s.unreadToken(generation)
+		return &scanValue{kind: valueScalar, token: token}, nil
+	default:
+		return &scanValue{kind: valueScalar, token: token}, nil
+	}
+}
+
+// isObjectKeyword reports whether a token ends the value of a malformed
+// object.
+func isObjectKeyword(token scanToken) bool {
+	if token.kind != tokenKeyword {
+		return false
+	}
+	switch token.value {
+	case "obj", "endobj", "stream", "endstream", ">>":
+		return true
+	}
+	return false
+}
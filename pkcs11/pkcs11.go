@@ -0,0 +1,382 @@
+//go:build cgo
+
+// Package pkcs11 provides a crypto.Signer for keys on hardware security
+// modules and smartcards that are accessed through a PKCS #11 library.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+// ckmEDDSA is CKM_EDDSA from PKCS #11 v3.0.
+const ckmEDDSA = 0x00001057
+
+// Config selects the token, key and certificate to sign with.
+type Config struct {
+	// Module is the path of the PKCS #11 library, for example
+	// /usr/lib/softhsm/libsofthsm2.so.
+	Module string
+
+	// TokenLabel or Slot select the token, when both are empty the only
+	// token present is used.
+	TokenLabel string
+	Slot       *uint
+
+	// PIN is the user PIN of the token.
+	PIN string
+
+	// KeyLabel and KeyID select the private key by CKA_LABEL and CKA_ID,
+	// when both are empty the only private key on the token is used.
+	KeyLabel string
+	KeyID    []byte
+
+	// Certificate is used instead of the certificate on the token with the
+	// same CKA_ID or CKA_LABEL as the key.
+	Certificate *x509.Certificate
+}
+
+// Signer signs with a private key on a PKCS #11 token. It is safe for
+// concurrent use, signing operations are serialized on a single session.
+type Signer struct {
+	ctx     *p11.Ctx
+	session p11.SessionHandle
+	key     p11.ObjectHandle
+	cert    *x509.Certificate
+
+	mu sync.Mutex
+}
+
+// Open loads the PKCS #11 module, logs in to the token and finds the key and
+// certificate. The Signer must be closed after use.
+func Open(config Config) (*Signer, error) {
+	if config.Module == "" {
+		return nil, errors.New("PKCS #11 module path is required")
+	}
+
+	ctx := p11.New(config.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS #11 module %s", config.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS #11 module: %w", err)
+	}
+
+	signer := &Signer{ctx: ctx}
+	if err := signer.open(config); err != nil {
+		signer.Close()
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+func (s *Signer) open(config Config) error {
+	slot, err := findSlot(s.ctx, config)
+	if err != nil {
+		return err
+	}
+
+	s.session, err = s.ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+
+	if config.PIN != "" {
+		err = s.ctx.Login(s.session, p11.CKU_USER, config.PIN)
+		if err != nil && !errors.Is(err, p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN)) {
+			return fmt.Errorf("failed to log in: %w", err)
+		}
+	}
+
+	template := []*p11.Attribute{p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY)}
+	if config.KeyLabel != "" {
+		template = append(template, p11.NewAttribute(p11.CKA_LABEL, config.KeyLabel))
+	}
+	if len(config.KeyID) > 0 {
+		template = append(template, p11.NewAttribute(p11.CKA_ID, config.KeyID))
+	}
+
+	keys, err := s.findObjects(template)
+	if err != nil {
+		return fmt.Errorf("failed to find private key: %w", err)
+	}
+	switch len(keys) {
+	case 0:
+		return errors.New("private key not found")
+	case 1:
+		s.key = keys[0]
+	default:
+		return fmt.Errorf("found %d private keys, select one by label or ID", len(keys))
+	}
+
+	s.cert = config.Certificate
+	if s.cert == nil {
+		s.cert, err = s.findCertificate()
+		if err != nil {
+			return err
+		}
+	}
+
+	switch s.cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported public key type %T", s.cert.PublicKey)
+	}
+
+	return nil
+}
+
+// findSlot returns the slot of the token selected by label or slot ID.
+func findSlot(ctx *p11.Ctx, config Config) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list slots: %w", err)
+	}
+
+	var found []uint
+	for _, slot := range slots {
+		if config.Slot != nil && slot != *config.Slot {
+			continue
+		}
+		if config.TokenLabel != "" {
+			info, err := ctx.GetTokenInfo(slot)
+			if err != nil {
+				return 0, fmt.Errorf("failed to get token info of slot %d: %w", slot, err)
+			}
+			// Token labels are padded with spaces.
+			if strings.TrimRight(info.Label, " \x00") != config.TokenLabel {
+				continue
+			}
+		}
+		found = append(found, slot)
+	}
+
+	switch len(found) {
+	case 0:
+		return 0, errors.New("token not found")
+	case 1:
+		return found[0], nil
+	default:
+		return 0, fmt.Errorf("found %d tokens, select one by label or slot", len(found))
+	}
+}
+
+// findObjects returns the objects matching the template.
+func (s *Signer) findObjects(template []*p11.Attribute) ([]p11.ObjectHandle, error) {
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return nil, err
+	}
+
+	var objects []p11.ObjectHandle
+	for {
+		found, _, err := s.ctx.FindObjects(s.session, 16)
+		if err != nil {
+			_ = s.ctx.FindObjectsFinal(s.session)
+			return nil, err
+		}
+		if len(found) == 0 {
+			break
+		}
+		objects = append(objects, found...)
+	}
+
+	return objects, s.ctx.FindObjectsFinal(s.session)
+}
+
+// findCertificate returns the certificate with the CKA_ID of the key, or with
+// its CKA_LABEL when the key has no ID.
+func (s *Signer) findCertificate() (*x509.Certificate, error) {
+	attributes, err := s.ctx.GetAttributeValue(s.session, s.key, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_ID, nil),
+		p11.NewAttribute(p11.CKA_LABEL, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key attributes: %w", err)
+	}
+
+	for _, attribute := range attributes {
+		if len(attribute.Value) == 0 {
+			continue
+		}
+
+		certs, err := s.findObjects([]*p11.Attribute{
+			p11.NewAttribute(p11.CKA_CLASS, p11.CKO_CERTIFICATE),
+			p11.NewAttribute(p11.CKA_CERTIFICATE_TYPE, p11.CKC_X_509),
+			p11.NewAttribute(attribute.Type, attribute.Value),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find certificate: %w", err)
+		}
+		if len(certs) == 0 {
+			continue
+		}
+
+		value, err := s.ctx.GetAttributeValue(s.session, certs[0], []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_VALUE, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %w", err)
+		}
+
+		cert, err := x509.ParseCertificate(value[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		return cert, nil
+	}
+
+	return nil, errors.New("certificate for the private key not found")
+}
+
+// Certificate returns the certificate of the key.
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Public returns the public key of the certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.cert.PublicKey
+}
+
+// Sign signs digest with the private key on the token. RSA keys sign with
+// PKCS #1 v1.5, or RSASSA-PSS when opts is *rsa.PSSOptions. ECDSA signatures
+// are returned ASN.1 encoded. Ed25519 keys sign the message itself, opts must
+// then be crypto.Hash(0).
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if hash != 0 && len(digest) != hash.Size() {
+		return nil, fmt.Errorf("digest length %d doesn't match %s", len(digest), hash)
+	}
+
+	var mechanism *p11.Mechanism
+	var data []byte
+
+	switch s.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			params, err := pssParams(hash, pss.SaltLength)
+			if err != nil {
+				return nil, err
+			}
+			mechanism = p11.NewMechanism(p11.CKM_RSA_PKCS_PSS, params)
+			data = digest
+			break
+		}
+
+		prefix, ok := digestInfoPrefixes[hash]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash algorithm %s", hash)
+		}
+		mechanism = p11.NewMechanism(p11.CKM_RSA_PKCS, nil)
+		data = append(append([]byte{}, prefix...), digest...)
+	case *ecdsa.PublicKey:
+		mechanism = p11.NewMechanism(p11.CKM_ECDSA, nil)
+		data = digest
+	case ed25519.PublicKey:
+		if hash != 0 {
+			return nil, errors.New("ed25519 signs the message, not a digest")
+		}
+		mechanism = p11.NewMechanism(ckmEDDSA, nil)
+		data = digest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.SignInit(s.session, []*p11.Mechanism{mechanism}, s.key); err != nil {
+		return nil, fmt.Errorf("failed to initialize signing: %w", err)
+	}
+	signature, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	if _, ok := s.cert.PublicKey.(*ecdsa.PublicKey); ok {
+		return ecdsaSignature(signature)
+	}
+
+	return signature, nil
+}
+
+// Close logs out and unloads the module.
+func (s *Signer) Close() error {
+	if s.ctx == nil {
+		return nil
+	}
+
+	if s.session != 0 {
+		_ = s.ctx.Logout(s.session)
+		_ = s.ctx.CloseSession(s.session)
+	}
+	err := s.ctx.Finalize()
+	s.ctx.Destroy()
+	s.ctx = nil
+
+	return err
+}
+
+// digestInfoPrefixes are the DER encoded DigestInfo prefixes of PKCS #1 v1.5
+// signatures, CKM_RSA_PKCS only pads the data.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pssMechanisms are the hash and MGF1 mechanisms of RSASSA-PSS.
+var pssMechanisms = map[crypto.Hash][2]uint{
+	crypto.SHA1:   {p11.CKM_SHA_1, p11.CKG_MGF1_SHA1},
+	crypto.SHA224: {p11.CKM_SHA224, p11.CKG_MGF1_SHA224},
+	crypto.SHA256: {p11.CKM_SHA256, p11.CKG_MGF1_SHA256},
+	crypto.SHA384: {p11.CKM_SHA384, p11.CKG_MGF1_SHA384},
+	crypto.SHA512: {p11.CKM_SHA512, p11.CKG_MGF1_SHA512},
+}
+
+// pssParams returns CK_RSA_PKCS_PSS_PARAMS for MGF1 with the same hash. Tokens
+// need an explicit salt length, rsa.PSSSaltLengthAuto uses the hash length.
+func pssParams(hash crypto.Hash, salt_length int) ([]byte, error) {
+	mechanisms, ok := pssMechanisms[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %s", hash)
+	}
+
+	switch {
+	case salt_length == rsa.PSSSaltLengthEqualsHash, salt_length == rsa.PSSSaltLengthAuto:
+		salt_length = hash.Size()
+	case salt_length < 0:
+		return nil, fmt.Errorf("invalid salt length %d", salt_length)
+	}
+
+	return p11.NewPSSParams(mechanisms[0], mechanisms[1], uint(salt_length)), nil
+}
+
+// ecdsaSignature converts the r || s signature of CKM_ECDSA to ASN.1.
+func ecdsaSignature(signature []byte) ([]byte, error) {
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, fmt.Errorf("invalid ECDSA signature length %d", len(signature))
+	}
+
+	half := len(signature) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(signature[:half]),
+		S: new(big.Int).SetBytes(signature[half:]),
+	})
+}
@@ -0,0 +1,305 @@
+//go:build cgo
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	p11 "github.com/miekg/pkcs11"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+const (
+	testTokenLabel = "pdfsign"
+	testPIN        = "1234"
+)
+
+// softHSMModules are the usual locations of the SoftHSM v2 library, the
+// SOFTHSM2_MODULE environment variable takes precedence.
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// initSoftHSM creates a SoftHSM token in a temporary directory and returns the
+// module path, the test is skipped when SoftHSM isn't installed.
+func initSoftHSM(t *testing.T) string {
+	t.Helper()
+
+	module := os.Getenv("SOFTHSM2_MODULE")
+	for _, path := range softHSMModules {
+		if module != "" {
+			break
+		}
+		if _, err := os.Stat(path); err == nil {
+			module = path
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSM is not installed")
+	}
+	util, err := exec.LookPath("softhsm2-util")
+	if err != nil {
+		t.Skip("softhsm2-util is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "softhsm2.conf")
+	err = os.WriteFile(config, []byte("directories.tokendir = "+dir+"\nobjectstore.backend = file\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", config)
+
+	output, err := exec.Command(util, "--init-token", "--free", "--label", testTokenLabel, "--pin", testPIN, "--so-pin", "5678").CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to initialize token: %s: %s", err, output)
+	}
+
+	return module
+}
+
+// importKey stores the key and a self-signed certificate for it on the token.
+func importKey(t *testing.T, module, label string, id []byte, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: label},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := p11.New(module)
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ctx.Finalize()
+		ctx.Destroy()
+	}()
+
+	slot, err := findSlot(ctx, Config{TokenLabel: testTokenLabel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ctx.CloseSession(session) }()
+	if err := ctx.Login(session, p11.CKU_USER, testPIN); err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY),
+		p11.NewAttribute(p11.CKA_TOKEN, true),
+		p11.NewAttribute(p11.CKA_PRIVATE, true),
+		p11.NewAttribute(p11.CKA_SIGN, true),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+		p11.NewAttribute(p11.CKA_ID, id),
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		attributes = append(attributes,
+			p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_RSA),
+			p11.NewAttribute(p11.CKA_MODULUS, key.N.Bytes()),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, big.NewInt(int64(key.E)).Bytes()),
+			p11.NewAttribute(p11.CKA_PRIVATE_EXPONENT, key.D.Bytes()),
+			p11.NewAttribute(p11.CKA_PRIME_1, key.Primes[0].Bytes()),
+			p11.NewAttribute(p11.CKA_PRIME_2, key.Primes[1].Bytes()),
+			p11.NewAttribute(p11.CKA_EXPONENT_1, key.Precomputed.Dp.Bytes()),
+			p11.NewAttribute(p11.CKA_EXPONENT_2, key.Precomputed.Dq.Bytes()),
+			p11.NewAttribute(p11.CKA_COEFFICIENT, key.Precomputed.Qinv.Bytes()),
+		)
+	case *ecdsa.PrivateKey:
+		curve, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+		attributes = append(attributes,
+			p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_EC),
+			p11.NewAttribute(p11.CKA_EC_PARAMS, curve),
+			p11.NewAttribute(p11.CKA_VALUE, key.D.Bytes()),
+		)
+	}
+	if _, err := ctx.CreateObject(session, attributes); err != nil {
+		t.Fatalf("failed to import key: %s", err)
+	}
+
+	_, err = ctx.CreateObject(session, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_CERTIFICATE),
+		p11.NewAttribute(p11.CKA_CERTIFICATE_TYPE, p11.CKC_X_509),
+		p11.NewAttribute(p11.CKA_TOKEN, true),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+		p11.NewAttribute(p11.CKA_ID, id),
+		p11.NewAttribute(p11.CKA_SUBJECT, cert.RawSubject),
+		p11.NewAttribute(p11.CKA_VALUE, cert.Raw),
+	})
+	if err != nil {
+		t.Fatalf("failed to import certificate: %s", err)
+	}
+
+	return cert
+}
+
+func TestSigner(t *testing.T) {
+	module := initSoftHSM(t)
+
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsa_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsa_cert := importKey(t, module, "rsa", []byte{1}, rsa_key)
+	ecdsa_cert := importKey(t, module, "ecdsa", []byte{2}, ecdsa_key)
+
+	// Multiple keys must be selected.
+	if _, err := Open(Config{Module: module, TokenLabel: testTokenLabel, PIN: testPIN}); err == nil {
+		t.Error("expected an error without a key label or ID")
+	}
+
+	rsa_signer, err := Open(Config{Module: module, TokenLabel: testTokenLabel, PIN: testPIN, KeyLabel: "rsa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rsa_signer.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if !rsa_signer.Certificate().Equal(rsa_cert) {
+		t.Error("expected the certificate with the ID of the key")
+	}
+
+	digest := sha256.Sum256([]byte("content"))
+	signature, err := rsa_signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(&rsa_key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("invalid PKCS #1 v1.5 signature: %s", err)
+	}
+
+	pss := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+	signature, err = rsa_signer.Sign(rand.Reader, digest[:], pss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPSS(&rsa_key.PublicKey, crypto.SHA256, digest[:], signature, pss); err != nil {
+		t.Errorf("invalid RSASSA-PSS signature: %s", err)
+	}
+
+	ecdsa_signer, err := Open(Config{Module: module, TokenLabel: testTokenLabel, PIN: testPIN, KeyID: []byte{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ecdsa_signer.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if !ecdsa_signer.Certificate().Equal(ecdsa_cert) {
+		t.Error("expected the certificate with the ID of the key")
+	}
+
+	signature, err = ecdsa_signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&ecdsa_key.PublicKey, digest[:], signature) {
+		t.Error("invalid ECDSA signature")
+	}
+
+	// Sign a document with the token.
+	for _, signer := range []*Signer{rsa_signer, ecdsa_signer} {
+		output := filepath.Join(t.TempDir(), "signed.pdf")
+		err := sign.SignFile("../testfiles/testfile20.pdf", output, sign.SignData{
+			Signature: sign.SignDataSignature{
+				Info: sign.SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: sign.ApprovalSignature,
+			},
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          signer,
+			Certificate:     signer.Certificate(),
+		})
+		if err != nil {
+			t.Fatalf("failed to sign: %s", err)
+		}
+
+		file, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := verify.VerifyFile(file)
+		_ = file.Close()
+		if err != nil {
+			t.Fatalf("failed to verify: %s", err)
+		}
+		if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+			t.Errorf("expected a valid signature, got %+v", response)
+		}
+	}
+}
+
+func TestECDSASignature(t *testing.T) {
+	signature, err := ecdsaSignature([]byte{0x00, 0x01, 0x80, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(signature, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.R.Int64() != 1 || parsed.S.Int64() != 0x8002 {
+		t.Errorf("unexpected r %s and s %s", parsed.R, parsed.S)
+	}
+
+	if _, err := ecdsaSignature([]byte{1, 2, 3}); err == nil {
+		t.Error("expected an error for an odd length")
+	}
+}
+
+func TestOpenWithoutModule(t *testing.T) {
+	if _, err := Open(Config{}); err == nil {
+		t.Error("expected an error without a module")
+	}
+	if _, err := Open(Config{Module: filepath.Join(t.TempDir(), "missing.so")}); err == nil {
+		t.Error("expected an error for a missing module")
+	}
+}
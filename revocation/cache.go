@@ -0,0 +1,200 @@
+package revocation
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores OCSP responses and CRLs until they expire, so they can be
+// reused for many signatures. A cache can be shared by the sign and verify
+// packages and must be safe for concurrent use.
+type Cache interface {
+	// Get returns the response stored under key, ok is false when there is
+	// no response or when it has expired.
+	Get(key string) (data []byte, ok bool)
+
+	// Set stores the response under key until expires.
+	Set(key string, data []byte, expires time.Time) error
+}
+
+// OCSPCacheKey returns the cache key of the OCSP response for the certificate,
+// responses are the same for each responder of the issuer.
+func OCSPCacheKey(cert, issuer *x509.Certificate) string {
+	issuer_hash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return fmt.Sprintf("ocsp/%x/%s", issuer_hash, cert.SerialNumber.Text(16))
+}
+
+// CRLCacheKey returns the cache key of the CRL at the distribution point.
+func CRLCacheKey(url string) string {
+	return "crl/" + url
+}
+
+// Expiry returns until when a response may be cached, based on the nextUpdate
+// of the OCSP response or CRL and the Cache-Control, Age and Expires headers of
+// the HTTP response, whichever is earlier. The zero time is returned when the
+// response must not be cached, either because the headers forbid it or
+// because neither gives an expiry.
+func Expiry(header http.Header, next_update time.Time, now time.Time) time.Time {
+	expires := next_update
+
+	max_age := -1
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(directive)), "=")
+		switch name {
+		case "no-store", "no-cache":
+			return time.Time{}
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				max_age = seconds
+			}
+		}
+	}
+
+	var http_expires time.Time
+	if max_age >= 0 {
+		age, _ := strconv.Atoi(header.Get("Age"))
+		http_expires = now.Add(time.Duration(max_age-age) * time.Second)
+	} else if value := header.Get("Expires"); value != "" {
+		// An invalid date means already expired.
+		http_expires, _ = http.ParseTime(value)
+		if http_expires.IsZero() {
+			return time.Time{}
+		}
+	}
+
+	if !http_expires.IsZero() && (expires.IsZero() || http_expires.Before(expires)) {
+		expires = http_expires
+	}
+	if !expires.After(now) {
+		return time.Time{}
+	}
+
+	return expires
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryCache is an in-memory Cache.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryCache returns an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]memoryEntry{}}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// Set implements Cache, expired responses are removed.
+func (c *MemoryCache) Set(key string, data []byte, expires time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = memoryEntry{data: data, expires: expires}
+	return nil
+}
+
+// DiskCache is a Cache that stores each response in a file in a directory,
+// the cache survives restarts and can be shared between processes.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a cache in the directory, it is created if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// path returns the file of the key, keys contain URLs so they are hashed.
+func (c *DiskCache) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:]))
+}
+
+// Get implements Cache. Each file starts with the expiry in Unix nanoseconds.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < 8 {
+		return nil, false
+	}
+
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	if !time.Now().Before(expires) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	return data[8:], true
+}
+
+// Set implements Cache, the file is replaced atomically.
+func (c *DiskCache) Set(key string, data []byte, expires time.Time) error {
+	if expires.IsZero() {
+		return errors.New("revocation cache: expiry is required")
+	}
+
+	file, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("revocation cache: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(expires.UnixNano()))
+	_, err = file.Write(append(header[:], data...))
+	if close_err := file.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		return fmt.Errorf("revocation cache: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("revocation cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package revocation
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	next_update := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		header      http.Header
+		next_update time.Time
+		expected    time.Time
+	}{
+		{"nextUpdate only", http.Header{}, next_update, next_update},
+		{"max-age earlier", http.Header{"Cache-Control": {"public, max-age=3600"}}, next_update, now.Add(time.Hour)},
+		{"max-age with age", http.Header{"Cache-Control": {"max-age=3600"}, "Age": {"600"}}, next_update, now.Add(50 * time.Minute)},
+		{"max-age later", http.Header{"Cache-Control": {"max-age=172800"}}, next_update, next_update},
+		{"max-age without nextUpdate", http.Header{"Cache-Control": {"max-age=60"}}, time.Time{}, now.Add(time.Minute)},
+		{"Expires", http.Header{"Expires": {now.Add(2 * time.Hour).Format(http.TimeFormat)}}, next_update, now.Add(2 * time.Hour)},
+		{"max-age over Expires", http.Header{"Cache-Control": {"max-age=60"}, "Expires": {now.Add(2 * time.Hour).Format(http.TimeFormat)}}, next_update, now.Add(time.Minute)},
+		{"invalid Expires", http.Header{"Expires": {"0"}}, next_update, time.Time{}},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, next_update, time.Time{}},
+		{"no-cache", http.Header{"Cache-Control": {"max-age=60, no-cache"}}, next_update, time.Time{}},
+		{"no expiry", http.Header{}, time.Time{}, time.Time{}},
+		{"expired", http.Header{}, now.Add(-time.Hour), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if expires := Expiry(tt.header, tt.next_update, now); !expires.Equal(tt.expected) {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, expires)
+		}
+	}
+}
+
+// testCache checks that a response is returned until it expires.
+func testCache(t *testing.T, cache Cache) {
+	t.Helper()
+
+	if _, ok := cache.Get("crl/http://example.com/ca.crl"); ok {
+		t.Fatal("expected an empty cache")
+	}
+
+	if err := cache.Set("crl/http://example.com/ca.crl", []byte("crl"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set("ocsp/expired", []byte("ocsp"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := cache.Get("crl/http://example.com/ca.crl")
+	if !ok || !bytes.Equal(data, []byte("crl")) {
+		t.Errorf("expected the cached CRL, got %q", data)
+	}
+	if _, ok := cache.Get("ocsp/expired"); ok {
+		t.Error("expected an expired response to be missing")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	testCache(t, NewMemoryCache())
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir() + "/cache"
+
+	cache, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, cache)
+
+	// Another instance, for example after a restart, uses the same files.
+	cache, err = NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get("crl/http://example.com/ca.crl"); !ok {
+		t.Error("expected the CRL to be cached on disk")
+	}
+
+	if err := cache.Set("crl/none", []byte("crl"), time.Time{}); err == nil {
+		t.Error("expected an error without expiry")
+	}
+}
@@ -17,6 +17,8 @@ func main() {
 		cli.SignCommand()
 	case "verify":
 		cli.VerifyCommand()
+	case "add-field":
+		cli.AddFieldCommand()
 	case "-h", "--help", "help":
 		cli.Usage()
 	default:
@@ -0,0 +1,149 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+	"github.com/digitorus/pkcs7"
+)
+
+var (
+	// RFC 8410, 3
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidEd448   = asn1.ObjectIdentifier{1, 3, 101, 113}
+)
+
+// Signature sizes of EdDSA (RFC 8032).
+const (
+	ed448SignatureSize = 114
+
+	// defaultSignatureSize is reserved for unknown key types, it fits an
+	// RSA-4096 signature.
+	defaultSignatureSize = 512
+)
+
+// publicKeyAlgorithm returns the algorithm of the subject public key of the
+// certificate, Go doesn't parse Ed448 public keys.
+func publicKeyAlgorithm(certificate *x509.Certificate) asn1.ObjectIdentifier {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(certificate.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil
+	}
+	return spki.Algorithm.Algorithm
+}
+
+// isPureEdDSA reports whether the certificate has an EdDSA key, EdDSA signs
+// the signed attributes directly instead of their digest (RFC 8419, 3.1).
+func isPureEdDSA(certificate *x509.Certificate) bool {
+	key_algorithm := publicKeyAlgorithm(certificate)
+	return key_algorithm.Equal(oidEd25519) || key_algorithm.Equal(oidEd448)
+}
+
+// signatureSize returns the maximum size of a signature value created with
+// the key of the certificate.
+func signatureSize(certificate *x509.Certificate) int {
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return key.Size()
+	case *ecdsa.PublicKey:
+		// Ecdsa-Sig-Value, a SEQUENCE of two INTEGERs that may need a
+		// leading zero.
+		return 2*((key.Curve.Params().BitSize+7)/8+3) + 3
+	case ed25519.PublicKey:
+		return ed25519.SignatureSize
+	}
+
+	if publicKeyAlgorithm(certificate).Equal(oidEd448) {
+		return ed448SignatureSize
+	}
+
+	return defaultSignatureSize
+}
+
+// verifyCMS verifies the signature of a CMS signed data against the digest of
+// its content, so the content doesn't have to be kept in memory. pkcs7 only
+// verifies against the content itself and doesn't support RSASSA-PSS.
+func verifyCMS(p7 *pkcs7.PKCS7, content_digest []byte) error {
+	if len(p7.Signers) != 1 {
+		return errors.New("expected exactly one signer")
+	}
+	signer := p7.Signers[0]
+
+	var signer_certificate *x509.Certificate
+	for _, certificate := range p7.Certificates {
+		if certificate.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 && bytes.Equal(certificate.RawIssuer, signer.IssuerAndSerialNumber.IssuerName.FullBytes) {
+			signer_certificate = certificate
+		}
+	}
+	if signer_certificate == nil {
+		return errors.New("no certificate for signer")
+	}
+
+	hash := algorithm.HashFromOID(signer.DigestAlgorithm.Algorithm)
+	if hash == 0 || !hash.Available() {
+		return fmt.Errorf("unsupported digest algorithm %s", signer.DigestAlgorithm.Algorithm)
+	}
+
+	var message_digest []byte
+	for _, attribute := range signer.AuthenticatedAttributes {
+		if attribute.Type.Equal(pkcs7.OIDAttributeMessageDigest) {
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &message_digest); err != nil {
+				return fmt.Errorf("invalid message digest: %w", err)
+			}
+		}
+	}
+	if subtle.ConstantTimeCompare(message_digest, content_digest) != 1 {
+		return errors.New("message digest mismatch")
+	}
+
+	signed_attributes, err := asn1.MarshalWithParams(signer.AuthenticatedAttributes, "set")
+	if err != nil {
+		return fmt.Errorf("marshal signed attributes: %w", err)
+	}
+
+	switch public_key := signer_certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if !signer.DigestEncryptionAlgorithm.Algorithm.Equal(algorithm.OIDRSASSAPSS) {
+			return rsa.VerifyPKCS1v15(public_key, hash, digest(hash, signed_attributes), signer.EncryptedDigest)
+		}
+
+		pss_hash, salt_length, err := algorithm.ParsePSSParameters(signer.DigestEncryptionAlgorithm)
+		if err != nil {
+			return err
+		}
+		if pss_hash != hash {
+			return errors.New("RSASSA-PSS hash differs from the digest algorithm")
+		}
+
+		if err := rsa.VerifyPSS(public_key, hash, digest(hash, signed_attributes), signer.EncryptedDigest, &rsa.PSSOptions{
+			SaltLength: salt_length,
+			Hash:       hash,
+		}); err != nil {
+			return fmt.Errorf("RSASSA-PSS: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(public_key, digest(hash, signed_attributes), signer.EncryptedDigest) {
+			return errors.New("ECDSA verification failure")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(public_key, signed_attributes, signer.EncryptedDigest) {
+			return errors.New("Ed25519 verification failure")
+		}
+	default:
+		return fmt.Errorf("unsupported public key algorithm %s", signer_certificate.PublicKeyAlgorithm)
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+	"github.com/digitorus/pkcs7"
+)
+
+// signatureInfo returns the parsed CMS signature of the last signature field.
+func signatureInfo(t *testing.T, signed []byte) *pkcs7.PKCS7 {
+	t.Helper()
+
+	rdr, err := NewReader(bytes.NewReader(signed), int64(len(signed)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	contents := existing.Index(existing.Len() - 1).Key("V").Key("Contents").RawString()
+
+	p7, err := pkcs7.Parse([]byte(contents))
+	if err != nil {
+		t.Fatalf("failed to parse signature: %s", err)
+	}
+	return p7
+}
+
+func TestSignRSAPSS(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384} {
+		output := t.TempDir() + "/signed.pdf"
+
+		err := SignFile("../testfiles/testfile20.pdf", output, SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			RSAPSS:          true,
+			DigestAlgorithm: hash,
+			Signer:          pkey,
+			Certificate:     cert,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign with %s: %s", hash, err)
+		}
+
+		signed := mustReadFile(t, output)
+		verifySignedBytes(t, signed)
+
+		p7 := signatureInfo(t, signed)
+		signature_algorithm := p7.Signers[0].DigestEncryptionAlgorithm
+		if !signature_algorithm.Algorithm.Equal(algorithm.OIDRSASSAPSS) {
+			t.Fatalf("expected id-RSASSA-PSS, got %s", signature_algorithm.Algorithm)
+		}
+
+		pss_hash, salt_length, err := algorithm.ParsePSSParameters(signature_algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pss_hash != hash || salt_length != hash.Size() {
+			t.Errorf("expected %s with a %d byte salt, got %s with %d", hash, hash.Size(), pss_hash, salt_length)
+		}
+
+		// The signature doesn't match other content.
+		if err := verifyCMS(p7, digest(hash, []byte("tampered"))); err == nil {
+			t.Error("expected verification to fail without the signed content")
+		}
+	}
+}
+
+func TestSignRSAPSSRequiresRSA(t *testing.T) {
+	cert, _ := loadCertificateAndKey(t)
+	cert.PublicKey = &struct{}{}
+
+	err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		RSAPSS:          true,
+		DigestAlgorithm: crypto.SHA256,
+		Certificate:     cert,
+	})
+	if err == nil {
+		t.Fatal("expected an error for a non-RSA certificate")
+	}
+}
+
+func TestPrepareFinalizeRSAPSS(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	prepared, prepared_pdf := prepareTestFile(t, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		RSAPSS:          true,
+		DigestAlgorithm: crypto.SHA256,
+		Certificate:     cert,
+	})
+
+	signature, err := rsa.SignPSS(rand.Reader, pkey, crypto.SHA256, prepared.SignedAttributesDigest, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bytes.Buffer
+	if err := prepared.Finalize(bytes.NewReader(prepared_pdf), &signed, signature, TSA{}); err != nil {
+		t.Fatalf("failed to finalize: %s", err)
+	}
+	verifySignedBytes(t, signed.Bytes())
+
+	// A PKCS #1 v1.5 signature doesn't match the RSASSA-PSS identifier.
+	signature, err = rsa.SignPKCS1v15(rand.Reader, pkey, crypto.SHA256, prepared.SignedAttributesDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepared.Finalize(bytes.NewReader(prepared_pdf), io.Discard, signature, TSA{}); err == nil {
+		t.Error("expected an error for a PKCS #1 v1.5 signature")
+	}
+}
+
+// createTestCertificate creates a self-signed document signing certificate
+// for the key.
+func createTestCertificate(t *testing.T, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "John Doe"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestSignEd25519(t *testing.T) {
+	_, pkey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := createTestCertificate(t, pkey)
+
+	output := t.TempDir() + "/signed.pdf"
+	err = SignFile("../testfiles/testfile20.pdf", output, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+
+	signed := mustReadFile(t, output)
+	verifySignedBytes(t, signed)
+
+	// RFC 8419: id-Ed25519 over the signed attributes with a SHA-512 message
+	// digest.
+	signer := signatureInfo(t, signed).Signers[0]
+	if !signer.DigestEncryptionAlgorithm.Algorithm.Equal(oidEd25519) {
+		t.Errorf("expected id-Ed25519, got %s", signer.DigestEncryptionAlgorithm.Algorithm)
+	}
+	if len(signer.DigestEncryptionAlgorithm.Parameters.FullBytes) != 0 {
+		t.Error("expected id-Ed25519 without parameters")
+	}
+	if !signer.DigestAlgorithm.Algorithm.Equal(algorithm.HashOIDs[crypto.SHA512]) {
+		t.Errorf("expected SHA-512 digest, got %s", signer.DigestAlgorithm.Algorithm)
+	}
+
+	signed_attributes, err := asn1.MarshalWithParams(signer.AuthenticatedAttributes, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pkey.Public().(ed25519.PublicKey), signed_attributes, signer.EncryptedDigest) {
+		t.Error("expected a signature over the signed attributes")
+	}
+}
+
+func TestSignatureSize(t *testing.T) {
+	rsa_cert, _ := loadCertificateAndKey(t)
+
+	ecdsa_key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519_key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		size int
+	}{
+		{"RSA-1024", rsa_cert, 128},
+		{"ECDSA P-384", createTestCertificate(t, ecdsa_key), 105},
+		{"Ed25519", createTestCertificate(t, ed25519_key), 64},
+		{"unknown", &x509.Certificate{}, defaultSignatureSize},
+	}
+
+	for _, tt := range tests {
+		if size := signatureSize(tt.cert); size != tt.size {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.size, size)
+		}
+	}
+
+	// An ECDSA signature never exceeds the reserved size.
+	digest := make([]byte, 48)
+	for i := 0; i < 32; i++ {
+		signature, err := ecdsa.SignASN1(rand.Reader, ecdsa_key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(signature) > signatureSize(tests[1].cert) {
+			t.Fatalf("signature of %d bytes exceeds the reserved size", len(signature))
+		}
+	}
+}
@@ -120,7 +120,8 @@ func (context *SignContext) createImageXObject() ([]byte, []byte, error) {
 
 		// If image has alpha channel, create soft mask
 		if hasAlpha(img) {
-			compressedAlphaData := compressData(alphaData.Bytes())
+			// The soft mask is placed after the image.
+			compressedAlphaData := context.encryptStream(context.getNextObjectID()+1, compressData(alphaData.Bytes()))
 
 			// Create and add the soft mask object
 			maskObjectBytes, err = context.createAlphaMask(width, height, compressedAlphaData)
@@ -134,7 +135,7 @@ func (context *SignContext) createImageXObject() ([]byte, []byte, error) {
 		return nil, nil, fmt.Errorf("unsupported image format: %s", format)
 	}
 
-	compressedRgbData := compressData(rgbData.Bytes())
+	compressedRgbData := context.encryptStream(context.getNextObjectID(), compressData(rgbData.Bytes()))
 
 	imageObject.WriteString(fmt.Sprintf("  /Length %d\n", len(compressedRgbData)))
 	imageObject.WriteString(">>\n")
@@ -291,9 +292,12 @@ func (context *SignContext) createAppearance(rect [4]float64) ([]byte, error) {
 		drawText(&appearance_stream_buffer, text, fontSize, textX, textY)
 	}
 
-	writeFormTypeAndLength(&appearance_buffer, appearance_stream_buffer.Len())
+	// The appearance is added after the image objects.
+	appearance_stream := context.encryptStream(context.getNextObjectID(), appearance_stream_buffer.Bytes())
 
-	writeAppearanceStreamBuffer(&appearance_buffer, appearance_stream_buffer.Bytes())
+	writeFormTypeAndLength(&appearance_buffer, len(appearance_stream))
+
+	writeAppearanceStreamBuffer(&appearance_buffer, appearance_stream)
 
 	return appearance_buffer.Bytes(), nil
 }
@@ -0,0 +1,106 @@
+package sign
+
+import (
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/digitorus/pkcs7"
+)
+
+var (
+	oidAttributeAdobeRevocation      = asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}
+	oidAttributeContentTimestamp     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 20}
+	oidAttributeSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidAttributeTimestampToken       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+)
+
+// findAttribute returns the first attribute of the type, or nil.
+func findAttribute(attributes []pkcs7.Attribute, oid asn1.ObjectIdentifier) *pkcs7.Attribute {
+	for i := range attributes {
+		if attributes[i].Type.Equal(oid) {
+			return &attributes[i]
+		}
+	}
+	return nil
+}
+
+// marshalAttribute returns the DER encoded attribute, with the value wrapped
+// in a SET as pkcs7 does.
+func marshalAttribute(attribute pkcs7.Attribute) ([]byte, error) {
+	value, err := asn1.Marshal(attribute.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(struct {
+		Type  asn1.ObjectIdentifier
+		Value asn1.RawValue `asn1:"set"`
+	}{
+		Type:  attribute.Type,
+		Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+	})
+}
+
+// extraSignedAttributes returns the signed attributes that are added next to
+// the content type, message digest, signing time, signing certificate and
+// Adobe revocation attributes.
+func (context *SignContext) extraSignedAttributes() ([]pkcs7.Attribute, error) {
+	var attributes []pkcs7.Attribute
+
+	if context.SignData.SignaturePolicy != nil {
+		policy, err := context.SignData.SignaturePolicy.attribute()
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, policy)
+	}
+
+	if context.SignData.CommitmentType != nil {
+		commitment, err := context.SignData.CommitmentType.attribute()
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, commitment)
+	}
+
+	signer_attributes, err := context.signerAttributesAttribute()
+	if err != nil {
+		return nil, err
+	}
+	if signer_attributes != nil {
+		attributes = append(attributes, *signer_attributes)
+	}
+
+	attributes = append(attributes, context.SignData.SignedAttributes...)
+
+	for i, attribute := range attributes {
+		// These are calculated by pkcs7 and can't be replaced.
+		if attribute.Type.Equal(pkcs7.OIDAttributeContentType) || attribute.Type.Equal(pkcs7.OIDAttributeMessageDigest) {
+			return nil, fmt.Errorf("signed attribute %s can't be set", attribute.Type)
+		}
+		if findAttribute(attributes[:i], attribute.Type) != nil {
+			return nil, fmt.Errorf("duplicate signed attribute %s", attribute.Type)
+		}
+	}
+
+	// The content timestamp is added once the ByteRange digest is known.
+	if context.SignData.ContentTimestamp && findAttribute(attributes, oidAttributeContentTimestamp) != nil {
+		return nil, fmt.Errorf("duplicate signed attribute %s", oidAttributeContentTimestamp)
+	}
+
+	return attributes, nil
+}
+
+// attributesSize returns the DER encoded size of the attributes.
+func attributesSize(attributes []pkcs7.Attribute) (int, error) {
+	size := 0
+	for _, attribute := range attributes {
+		encoded, err := marshalAttribute(attribute)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attribute %s: %w", attribute.Type, err)
+		}
+		size += len(encoded)
+	}
+	return size, nil
+}
@@ -0,0 +1,125 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+func TestSignCustomAttributes(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	// ETSI EN 319 122-1 signer-location with a locality name.
+	location := pkcs7.Attribute{
+		Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 17},
+		Value: struct {
+			Locality asn1.RawValue `asn1:"optional,explicit,tag:1"`
+		}{
+			Locality: asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte("Amsterdam")},
+		},
+	}
+	signing_time := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+
+	// A large unsigned attribute checks that the reserved size includes it.
+	note_type := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	note := bytes.Repeat([]byte("note "), 1000)
+
+	output := t.TempDir() + "/signed.pdf"
+	err := SignFile("../testfiles/testfile20.pdf", output, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+		TSA:             TSA{URL: tsa.URL},
+		SignedAttributes: []pkcs7.Attribute{
+			location,
+			{Type: pkcs7.OIDAttributeSigningTime, Value: signing_time},
+		},
+		UnsignedAttributes: []pkcs7.Attribute{
+			{Type: note_type, Value: note},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+
+	signed := mustReadFile(t, output)
+	verifySignedBytes(t, signed)
+
+	signer := signatureInfo(t, signed).Signers[0]
+
+	signing_times := 0
+	found_location := false
+	for _, attribute := range signer.AuthenticatedAttributes {
+		switch {
+		case attribute.Type.Equal(pkcs7.OIDAttributeSigningTime):
+			signing_times++
+			var value time.Time
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &value); err != nil || !value.Equal(signing_time) {
+				t.Errorf("expected the custom signing time, got %s", value)
+			}
+		case attribute.Type.Equal(location.Type):
+			found_location = true
+		}
+	}
+	if signing_times != 1 {
+		t.Errorf("expected a single signing time, got %d", signing_times)
+	}
+	if !found_location {
+		t.Error("signer-location attribute not found")
+	}
+
+	unsigned := map[string]bool{}
+	for _, attribute := range signer.UnauthenticatedAttributes {
+		unsigned[attribute.Type.String()] = true
+		if attribute.Type.Equal(note_type) {
+			var value []byte
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &value); err != nil || !bytes.Equal(value, note) {
+				t.Error("unexpected unsigned attribute value")
+			}
+		}
+	}
+	if len(unsigned) != 2 || !unsigned[note_type.String()] || !unsigned[oidAttributeTimestampToken.String()] {
+		t.Errorf("expected the custom attribute and the timestamp, got %v", unsigned)
+	}
+}
+
+func TestSignCustomAttributesErrors(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tests := []struct {
+		name       string
+		attributes []pkcs7.Attribute
+		err        string
+	}{
+		{"message digest", []pkcs7.Attribute{{Type: pkcs7.OIDAttributeMessageDigest, Value: []byte{1}}}, "can't be set"},
+		{"content type", []pkcs7.Attribute{{Type: pkcs7.OIDAttributeContentType, Value: pkcs7.OIDData}}, "can't be set"},
+		{"duplicate", []pkcs7.Attribute{
+			{Type: pkcs7.OIDAttributeSigningTime, Value: time.Now()},
+			{Type: pkcs7.OIDAttributeSigningTime, Value: time.Now()},
+		}, "duplicate"},
+	}
+
+	for _, tt := range tests {
+		err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+			Signature: SignDataSignature{
+				CertType: ApprovalSignature,
+			},
+			DigestAlgorithm:  crypto.SHA256,
+			Signer:           pkey,
+			Certificate:      cert,
+			SignedAttributes: tt.attributes,
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sign
+
+import (
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// ETSI EN 319 122-1, 5.2.3
+var oidAttributeCommitmentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 16}
+
+// CommitmentType states what the signer commits to with the signature, it
+// is added as the commitment-type-indication signed attribute. Other
+// commitment types can be used by their OID.
+type CommitmentType asn1.ObjectIdentifier
+
+// Commitment types of RFC 5126, 5.11.1.
+var (
+	CommitmentProofOfOrigin   = CommitmentType{1, 2, 840, 113549, 1, 9, 16, 6, 1}
+	CommitmentProofOfReceipt  = CommitmentType{1, 2, 840, 113549, 1, 9, 16, 6, 2}
+	CommitmentProofOfDelivery = CommitmentType{1, 2, 840, 113549, 1, 9, 16, 6, 3}
+	CommitmentProofOfSender   = CommitmentType{1, 2, 840, 113549, 1, 9, 16, 6, 4}
+	CommitmentProofOfApproval = CommitmentType{1, 2, 840, 113549, 1, 9, 16, 6, 5}
+	CommitmentProofOfCreation = CommitmentType{1, 2, 840, 113549, 1, 9, 16, 6, 6}
+)
+
+func (c CommitmentType) String() string {
+	return asn1.ObjectIdentifier(c).String()
+}
+
+// attribute returns the commitment-type-indication attribute without
+// qualifiers.
+func (c CommitmentType) attribute() (pkcs7.Attribute, error) {
+	if len(c) < 2 {
+		return pkcs7.Attribute{}, fmt.Errorf("invalid commitment type %v", []int(c))
+	}
+
+	return pkcs7.Attribute{
+		Type: oidAttributeCommitmentType,
+		Value: struct {
+			CommitmentTypeID asn1.ObjectIdentifier
+		}{asn1.ObjectIdentifier(c)},
+	}, nil
+}
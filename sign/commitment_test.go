@@ -0,0 +1,70 @@
+package sign
+
+import (
+	"crypto"
+	"os"
+	"testing"
+
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignCommitmentType(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tests := []struct {
+		commitment CommitmentType
+		oid        string
+		name       string
+	}{
+		{CommitmentProofOfApproval, "1.2.840.113549.1.9.16.6.5", "ProofOfApproval"},
+		{CommitmentProofOfOrigin, "1.2.840.113549.1.9.16.6.1", "ProofOfOrigin"},
+		{CommitmentType{1, 3, 6, 1, 4, 1, 99999, 2}, "1.3.6.1.4.1.99999.2", ""},
+	}
+
+	for _, tt := range tests {
+		output := t.TempDir() + "/signed.pdf"
+		err := SignFile("../testfiles/testfile20.pdf", output, SignData{
+			Signature: SignDataSignature{
+				CertType: ApprovalSignature,
+			},
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+			CommitmentType:  tt.commitment,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign: %s", err)
+		}
+
+		file, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := verify.VerifyFile(file)
+		_ = file.Close()
+		if err != nil {
+			t.Fatalf("failed to verify: %s", err)
+		}
+		if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+			t.Fatalf("expected a valid signature, got %+v", response)
+		}
+
+		commitment := response.Signers[0].CommitmentType
+		if commitment == nil || commitment.OID != tt.oid || commitment.Name != tt.name {
+			t.Errorf("expected commitment type %s (%s), got %+v", tt.oid, tt.name, commitment)
+		}
+	}
+
+	err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+		CommitmentType:  CommitmentType{1},
+	})
+	if err == nil {
+		t.Error("expected an error for an invalid commitment type")
+	}
+}
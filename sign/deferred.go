@@ -0,0 +1,273 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pkcs7"
+)
+
+// PreparedSignature contains the data of a document prepared for deferred
+// signing, where the signature value or the complete CMS is created outside
+// of this process. It only holds serializable data so it can be stored
+// between the two phases, the prepared document itself is written by Prepare
+// and passed again to Finalize.
+type PreparedSignature struct {
+	// ByteRange of the signature in the prepared document.
+	ByteRange []int64
+
+	// SignatureMaxLength is the size reserved for the hex encoded signature.
+	SignatureMaxLength uint32
+
+	// Digest is the digest of the ByteRange using DigestAlgorithm, to be used
+	// by services that create the complete CMS themselves.
+	Digest []byte
+
+	// SignedAttributes is the DER encoded SET OF signed attributes over which
+	// the signature value must be calculated.
+	SignedAttributes []byte
+
+	// SignedAttributesDigest is the digest of SignedAttributes using
+	// DigestAlgorithm, to be used by services that sign a pre-computed hash.
+	// Ed25519 signs SignedAttributes directly, with RSAPSS the signature must
+	// be RSASSA-PSS with a salt of the digest length.
+	SignedAttributesDigest []byte
+
+	// Certificates are the DER encoded signer certificate followed by the
+	// rest of its chain.
+	Certificates [][]byte
+
+	DigestAlgorithm crypto.Hash
+	RSAPSS          bool
+
+	// UnsignedAttributes are the DER encoded unsigned attributes of the
+	// signer.
+	UnsignedAttributes [][]byte
+}
+
+// Prepare writes the document with the incremental update and a signature
+// placeholder to output and returns the data to sign, the first phase of
+// deferred signing. Only the certificate (chain) of the signer is required.
+func Prepare(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, sign_data SignData) (*PreparedSignature, error) {
+	if sign_data.Signature.CertType == TimeStampSignature {
+		return nil, fmt.Errorf("deferred signing is not supported for timestamp signatures")
+	}
+
+	context, err := newSignContext(input, output, rdr, size, sign_data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := context.preparePDF(); err != nil {
+		return nil, err
+	}
+
+	content_digest, err := context.hashSignContent()
+	if err != nil {
+		return nil, err
+	}
+
+	signed_data, err := context.createSignedData(content_digest)
+	if err != nil {
+		return nil, err
+	}
+
+	signed_attributes, err := asn1.MarshalWithParams(signed_data.GetSignedData().SignerInfos[0].AuthenticatedAttributes, "set")
+	if err != nil {
+		return nil, fmt.Errorf("marshal signed attributes: %w", err)
+	}
+
+	certificates := [][]byte{context.SignData.Certificate.Raw}
+	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 1 {
+		for _, certificate := range context.SignData.CertificateChains[0][1:] {
+			certificates = append(certificates, certificate.Raw)
+		}
+	}
+
+	var unsigned_attributes [][]byte
+	for _, attribute := range context.SignData.UnsignedAttributes {
+		unsigned_attribute, err := marshalAttribute(attribute)
+		if err != nil {
+			return nil, fmt.Errorf("marshal unsigned attribute: %w", err)
+		}
+		unsigned_attributes = append(unsigned_attributes, unsigned_attribute)
+	}
+
+	if err := context.writeOutput(); err != nil {
+		return nil, err
+	}
+
+	return &PreparedSignature{
+		ByteRange:              context.ByteRangeValues,
+		SignatureMaxLength:     context.SignatureMaxLength,
+		Digest:                 content_digest,
+		SignedAttributes:       signed_attributes,
+		SignedAttributesDigest: digest(context.SignData.DigestAlgorithm, signed_attributes),
+		Certificates:           certificates,
+		DigestAlgorithm:        context.SignData.DigestAlgorithm,
+		RSAPSS:                 context.SignData.RSAPSS,
+		UnsignedAttributes:     unsigned_attributes,
+	}, nil
+}
+
+// Finalize creates the CMS signature using the externally created signature
+// value over SignedAttributes and writes the signed document to output, the
+// prepared document is the output of Prepare. A signature timestamp is added
+// when tsa has a URL, it should be the TSA passed to Prepare as the size of
+// the timestamp token is reserved there. The TSA isn't stored in the
+// PreparedSignature as it may hold credentials and clients.
+func (p *PreparedSignature) Finalize(prepared io.ReaderAt, output io.Writer, signature []byte, tsa TSA) error {
+	if err := p.checkDigest(prepared); err != nil {
+		return err
+	}
+
+	sign_data, err := p.signData(tsa)
+	if err != nil {
+		return err
+	}
+	context := &SignContext{SignData: sign_data}
+
+	signed_data, err := context.createSignedData(p.Digest)
+	if err != nil {
+		return err
+	}
+
+	// Use the signed attributes from the first phase, they include the
+	// signing time and the content timestamp.
+	signer_info := &signed_data.GetSignedData().SignerInfos[0]
+	if _, err := asn1.UnmarshalWithParams(p.SignedAttributes, &signer_info.AuthenticatedAttributes, "set"); err != nil {
+		return fmt.Errorf("unmarshal signed attributes: %w", err)
+	}
+	signer_info.EncryptedDigest = signature
+
+	cms, err := context.finishSignedData(signed_data)
+	if err != nil {
+		return err
+	}
+
+	return p.inject(prepared, output, cms)
+}
+
+// FinalizeCMS injects an externally created detached CMS signature over the
+// ByteRange and writes the signed document to output, the prepared document
+// is the output of Prepare.
+func (p *PreparedSignature) FinalizeCMS(prepared io.ReaderAt, output io.Writer, cms []byte) error {
+	if err := p.checkDigest(prepared); err != nil {
+		return err
+	}
+
+	return p.inject(prepared, output, cms)
+}
+
+// checkDigest verifies that the prepared document matches the prepared
+// signature, the ByteRange is hashed without reading the document into
+// memory.
+func (p *PreparedSignature) checkDigest(prepared io.ReaderAt) error {
+	if len(p.ByteRange) != 4 || p.ByteRange[0] != 0 || p.ByteRange[1] < 0 || p.ByteRange[2] != p.ByteRange[1]+int64(p.SignatureMaxLength)+2 || p.ByteRange[3] < 0 {
+		return fmt.Errorf("invalid byte range")
+	}
+	if !p.DigestAlgorithm.Available() {
+		return fmt.Errorf("unsupported digest algorithm %d", p.DigestAlgorithm)
+	}
+
+	h := p.DigestAlgorithm.New()
+	if _, err := io.Copy(h, io.MultiReader(
+		io.NewSectionReader(prepared, p.ByteRange[0], p.ByteRange[1]),
+		io.NewSectionReader(prepared, p.ByteRange[2], p.ByteRange[3]),
+	)); err != nil {
+		return fmt.Errorf("failed to hash byte range: %w", err)
+	}
+
+	if !bytes.Equal(h.Sum(nil), p.Digest) {
+		return fmt.Errorf("prepared document does not match its digest")
+	}
+
+	return nil
+}
+
+// signData returns the SignData of the second phase from the serialized
+// fields and the TSA, the Signer is not used.
+func (p *PreparedSignature) signData(tsa TSA) (SignData, error) {
+	if len(p.Certificates) == 0 {
+		return SignData{}, fmt.Errorf("no signer certificate")
+	}
+
+	var chain []*x509.Certificate
+	for _, der := range p.Certificates {
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return SignData{}, fmt.Errorf("parse certificate: %w", err)
+		}
+		chain = append(chain, certificate)
+	}
+
+	var unsigned_attributes []pkcs7.Attribute
+	for _, der := range p.UnsignedAttributes {
+		var attribute struct {
+			Type  asn1.ObjectIdentifier
+			Value asn1.RawValue `asn1:"set"`
+		}
+		if _, err := asn1.Unmarshal(der, &attribute); err != nil {
+			return SignData{}, fmt.Errorf("unmarshal unsigned attribute: %w", err)
+		}
+		unsigned_attributes = append(unsigned_attributes, pkcs7.Attribute{
+			Type:  attribute.Type,
+			Value: asn1.RawValue{FullBytes: attribute.Value.Bytes},
+		})
+	}
+
+	return SignData{
+		Certificate:        chain[0],
+		CertificateChains:  [][]*x509.Certificate{chain},
+		DigestAlgorithm:    p.DigestAlgorithm,
+		RSAPSS:             p.RSAPSS,
+		UnsignedAttributes: unsigned_attributes,
+		TSA:                tsa,
+	}, nil
+}
+
+// inject verifies the CMS signature against the digest of the document and
+// writes the prepared document to output with the signature in the
+// /Contents placeholder.
+func (p *PreparedSignature) inject(prepared io.ReaderAt, output io.Writer, cms []byte) error {
+	p7, err := pkcs7.Parse(cms)
+	if err != nil {
+		return fmt.Errorf("parse signature: %w", err)
+	}
+
+	if err := verifyCMS(p7, p.Digest); err != nil {
+		return fmt.Errorf("verify signature: %w", err)
+	}
+
+	contents := hex.EncodeToString(cms)
+	if len(contents) > int(p.SignatureMaxLength) {
+		return &SignatureSizeError{
+			Size:     len(cms),
+			Reserved: int(p.SignatureMaxLength) / 2,
+		}
+	}
+
+	// The placeholder after the hex encoded signature keeps its zeros.
+	contents_start := p.ByteRange[1] + 1
+	if _, err := io.Copy(output, io.MultiReader(
+		io.NewSectionReader(prepared, 0, contents_start),
+		bytes.NewReader([]byte(contents)),
+		io.NewSectionReader(prepared, contents_start+int64(len(contents)), p.ByteRange[2]+p.ByteRange[3]-contents_start-int64(len(contents))),
+	)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func digest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,243 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+func prepareTestFile(t *testing.T, sign_data SignData) (*PreparedSignature, []byte) {
+	t.Helper()
+
+	input_file, err := os.Open("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	finfo, err := input_file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := pdf.NewReader(input_file, finfo.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	prepared, err := Prepare(input_file, &output, rdr, finfo.Size(), sign_data)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err.Error())
+	}
+
+	return prepared, output.Bytes()
+}
+
+func verifySignedBytes(t *testing.T, signed []byte) {
+	t.Helper()
+
+	tmpfile, err := os.CreateTemp(t.TempDir(), "signed-*.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = tmpfile.Close()
+	}()
+
+	if _, err := tmpfile.Write(signed); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := verify.VerifyFile(tmpfile)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err.Error())
+	}
+	if len(response.Signers) == 0 {
+		t.Fatal("no signers found")
+	}
+	for i, signer := range response.Signers {
+		if !signer.ValidSignature {
+			t.Errorf("signature %d is not valid: %s", i, response.Error)
+		}
+	}
+}
+
+func TestPrepareFinalize(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	prepared, prepared_pdf := prepareTestFile(t, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Certificate:     cert,
+	})
+
+	// The prepared signature is stored between the two phases.
+	stored, err := json.Marshal(prepared)
+	if err != nil {
+		t.Fatalf("failed to serialize: %s", err.Error())
+	}
+	prepared = &PreparedSignature{}
+	if err := json.Unmarshal(stored, prepared); err != nil {
+		t.Fatal(err)
+	}
+
+	// The external service only receives the digest of the signed attributes.
+	signature, err := rsa.SignPKCS1v15(rand.Reader, pkey, crypto.SHA256, prepared.SignedAttributesDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bytes.Buffer
+	if err := prepared.Finalize(bytes.NewReader(prepared_pdf), &signed, signature, TSA{}); err != nil {
+		t.Fatalf("failed to finalize: %s", err.Error())
+	}
+
+	verifySignedBytes(t, signed.Bytes())
+
+	if err := prepared.Finalize(bytes.NewReader(prepared_pdf), io.Discard, []byte("invalid"), TSA{}); err == nil {
+		t.Error("expected an error for an invalid signature")
+	}
+
+	// The prepared document must not be changed between the two phases.
+	tampered := bytes.Clone(prepared_pdf)
+	tampered[0] = '!'
+	if err := prepared.Finalize(bytes.NewReader(tampered), io.Discard, signature, TSA{}); err == nil {
+		t.Error("expected an error for a changed document")
+	}
+}
+
+func TestPrepareFinalizeTSA(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	// The TSA requires the credentials, which are only passed to Finalize.
+	var requests atomic.Int32
+	handler := newTestTSAHandler(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	prepared, prepared_pdf := prepareTestFile(t, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Certificate:     cert,
+		TSA:             TSA{URL: server.URL, TokenSize: 4096},
+	})
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, pkey, crypto.SHA256, prepared.SignedAttributesDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bytes.Buffer
+	if err := prepared.Finalize(bytes.NewReader(prepared_pdf), &signed, signature, TSA{URL: server.URL}); err == nil {
+		t.Error("expected an error without the TSA credentials")
+	}
+
+	signed.Reset()
+	if err := prepared.Finalize(bytes.NewReader(prepared_pdf), &signed, signature, TSA{URL: server.URL, Username: "user", Password: "secret"}); err != nil {
+		t.Fatalf("failed to finalize: %s", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 TSA request, got %d", requests.Load())
+	}
+
+	verifySignedBytes(t, signed.Bytes())
+}
+
+func TestPrepareFinalizeCMS(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	prepared, prepared_pdf := prepareTestFile(t, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Certificate:     cert,
+	})
+
+	// Create the complete CMS over the ByteRange externally.
+	var content []byte
+	content = append(content, prepared_pdf[prepared.ByteRange[0]:prepared.ByteRange[0]+prepared.ByteRange[1]]...)
+	content = append(content, prepared_pdf[prepared.ByteRange[2]:prepared.ByteRange[2]+prepared.ByteRange[3]]...)
+
+	signed_data, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed_data.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signed_data.AddSigner(cert, pkey, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	signed_data.Detach()
+
+	cms, err := signed_data.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bytes.Buffer
+	if err := prepared.FinalizeCMS(bytes.NewReader(prepared_pdf), &signed, cms); err != nil {
+		t.Fatalf("failed to finalize: %s", err.Error())
+	}
+
+	verifySignedBytes(t, signed.Bytes())
+}
+
+func TestPrepareTimeStampSignature(t *testing.T) {
+	input_file, err := os.Open("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	finfo, err := input_file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := pdf.NewReader(input_file, finfo.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Prepare(input_file, io.Discard, rdr, finfo.Size(), SignData{
+		Signature: SignDataSignature{
+			CertType: TimeStampSignature,
+		},
+	})
+	if err == nil {
+		t.Error("expected an error for a timestamp signature")
+	}
+}
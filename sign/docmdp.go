@@ -0,0 +1,129 @@
+package sign
+
+import (
+	"fmt"
+
+	"github.com/digitorus/pdf"
+)
+
+// DocMDPError is returned when the document is certified and the new
+// signature would invalidate the certification: a second certification
+// signature, or any signature other than a document timestamp when the
+// certification allows no changes. SignData.IgnoreDocMDP signs anyway.
+type DocMDPError struct {
+	Permission DocMDPPerm // Access permissions of the existing certification
+	CertType   CertType   // Type of the refused signature
+	AddFields  bool       // Signature fields are refused instead of a signature
+}
+
+func (e *DocMDPError) Error() string {
+	if e.AddFields {
+		return fmt.Sprintf("document is certified with DocMDP permission %d (%s), adding signature fields invalidates the certification", e.Permission, e.Permission)
+	}
+	if e.CertType == CertificationSignature {
+		return "document is already certified, a second certification signature invalidates the certification"
+	}
+	return fmt.Sprintf("document is certified with DocMDP permission %d (%s), a %s invalidates the certification", e.Permission, e.Permission, e.CertType)
+}
+
+// checkDocMDP refuses signatures that are not permitted by the certification
+// signature of the document.
+func (context *SignContext) checkDocMDP() error {
+	if context.SignData.IgnoreDocMDP {
+		return nil
+	}
+
+	permission, certified := context.docMDPPermission()
+	if !certified {
+		return nil
+	}
+
+	switch context.SignData.Signature.CertType {
+	case CertificationSignature:
+		return &DocMDPError{Permission: permission, CertType: CertificationSignature}
+	case TimeStampSignature:
+		// Document timestamps are not considered changes to the document.
+		return nil
+	}
+
+	if permission == DoNotAllowAnyChangesPerms {
+		return &DocMDPError{Permission: permission, CertType: context.SignData.Signature.CertType}
+	}
+
+	return nil
+}
+
+// checkFieldsDocMDP refuses new signature fields unless the certification
+// signature of the document allows creating annotations and form fields.
+func (context *SignContext) checkFieldsDocMDP() error {
+	if context.SignData.IgnoreDocMDP {
+		return nil
+	}
+
+	permission, certified := context.docMDPPermission()
+	if certified && permission != AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms {
+		return &DocMDPError{Permission: permission, AddFields: true}
+	}
+
+	return nil
+}
+
+// docMDPPermission returns the access permissions of the certification
+// signature of the document, found by the /Perms entry of the catalog or the
+// signature references of the signed fields.
+func (context *SignContext) docMDPPermission() (DocMDPPerm, bool) {
+	root := context.PDFReader.Trailer().Key("Root")
+
+	if permission, ok := docMDPReference(root.Key("Perms").Key("DocMDP")); ok {
+		return permission, true
+	}
+
+	return docMDPFieldsRec(root.Key("AcroForm").Key("Fields"), "")
+}
+
+// docMDPFieldsRec walks the field hierarchy for a signature with a DocMDP
+// reference, the field type is inheritable.
+func docMDPFieldsRec(fields pdf.Value, parent_type string) (DocMDPPerm, bool) {
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Index(i)
+
+		field_type := parent_type
+		if ft := field.Key("FT"); !ft.IsNull() {
+			field_type = ft.Name()
+		}
+
+		if field_type == "Sig" {
+			if permission, ok := docMDPReference(field.Key("V")); ok {
+				return permission, true
+			}
+		}
+
+		if kids := field.Key("Kids"); kids.Len() > 0 {
+			if permission, ok := docMDPFieldsRec(kids, field_type); ok {
+				return permission, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// docMDPReference returns the P entry of the DocMDP transform parameters of a
+// signature dictionary (Table 257), 2 when absent or invalid.
+func docMDPReference(signature pdf.Value) (DocMDPPerm, bool) {
+	references := signature.Key("Reference")
+	for i := 0; i < references.Len(); i++ {
+		reference := references.Index(i)
+		if reference.Key("TransformMethod").Name() != "DocMDP" {
+			continue
+		}
+
+		permission := DocMDPPerm(reference.Key("TransformParams").Key("P").Int64())
+		if permission < DoNotAllowAnyChangesPerms || permission > AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms {
+			permission = AllowFillingExistingFormFieldsAndSignaturesPerms
+		}
+		return permission, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,128 @@
+package sign
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+)
+
+func TestSignDocMDP(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+	tmpdir := t.TempDir()
+
+	signData := func(cert_type CertType, permission DocMDPPerm) SignData {
+		return SignData{
+			Signature: SignDataSignature{
+				CertType:   cert_type,
+				DocMDPPerm: permission,
+			},
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+			TSA:             TSA{URL: tsa.URL},
+		}
+	}
+
+	certified := func(permission DocMDPPerm) string {
+		t.Helper()
+
+		output := tmpdir + "/certified_" + permission.String() + ".pdf"
+		if err := SignFile("../testfiles/testfile20.pdf", output, signData(CertificationSignature, permission)); err != nil {
+			t.Fatalf("failed to certify: %s", err)
+		}
+		return output
+	}
+
+	no_changes := certified(DoNotAllowAnyChangesPerms)
+	form_filling := certified(AllowFillingExistingFormFieldsAndSignaturesPerms)
+
+	tests := []struct {
+		name       string
+		input      string
+		cert_type  CertType
+		permission DocMDPPerm // of the refused certification, zero when allowed
+	}{
+		{"approval of a document without changes", no_changes, ApprovalSignature, DoNotAllowAnyChangesPerms},
+		{"usage rights of a document without changes", no_changes, UsageRightsSignature, DoNotAllowAnyChangesPerms},
+		{"second certification", form_filling, CertificationSignature, AllowFillingExistingFormFieldsAndSignaturesPerms},
+		{"approval with form filling", form_filling, ApprovalSignature, 0},
+		{"document timestamp", no_changes, TimeStampSignature, 0},
+	}
+
+	for _, tt := range tests {
+		output := tmpdir + "/signed.pdf"
+		sign_data := signData(tt.cert_type, DoNotAllowAnyChangesPerms)
+
+		err := SignFile(tt.input, output, sign_data)
+		if tt.permission == 0 {
+			if err != nil {
+				t.Fatalf("%s: expected the signature to be allowed, got %s", tt.name, err)
+			}
+			verifySignedBytes(t, mustReadFile(t, output))
+			continue
+		}
+
+		var docmdp_error *DocMDPError
+		if !errors.As(err, &docmdp_error) {
+			t.Fatalf("%s: expected a DocMDPError, got %v", tt.name, err)
+		}
+		if docmdp_error.Permission != tt.permission || docmdp_error.CertType != tt.cert_type {
+			t.Errorf("%s: unexpected error %+v", tt.name, docmdp_error)
+		}
+
+		// The override signs anyway.
+		sign_data.IgnoreDocMDP = true
+		if err := SignFile(tt.input, output, sign_data); err != nil {
+			t.Fatalf("%s: expected IgnoreDocMDP to sign, got %s", tt.name, err)
+		}
+	}
+}
+
+func TestAddSignatureFieldsDocMDP(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tmpdir := t.TempDir()
+
+	fields := []SignatureField{{Name: "approver", Page: 1, LowerLeftX: 100, LowerLeftY: 100, UpperRightX: 300, UpperRightY: 150}}
+
+	for _, permission := range []DocMDPPerm{
+		DoNotAllowAnyChangesPerms,
+		AllowFillingExistingFormFieldsAndSignaturesPerms,
+		AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms,
+	} {
+		certified := tmpdir + "/certified_" + permission.String() + ".pdf"
+		err := SignFile("../testfiles/testfile20.pdf", certified, SignData{
+			Signature: SignDataSignature{
+				CertType:   CertificationSignature,
+				DocMDPPerm: permission,
+			},
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+		})
+		if err != nil {
+			t.Fatalf("failed to certify: %s", err)
+		}
+
+		// Only annotation changes allow new signature fields.
+		err = AddSignatureFieldsFile(certified, tmpdir+"/fields.pdf", fields, SignatureFieldsOptions{})
+		if permission == AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms {
+			if err != nil {
+				t.Errorf("%s: expected the fields to be allowed, got %s", permission, err)
+			}
+			continue
+		}
+
+		var docmdp_error *DocMDPError
+		if !errors.As(err, &docmdp_error) {
+			t.Fatalf("%s: expected a DocMDPError, got %v", permission, err)
+		}
+		if docmdp_error.Permission != permission || !docmdp_error.AddFields {
+			t.Errorf("%s: unexpected error %+v", permission, docmdp_error)
+		}
+
+		if err := AddSignatureFieldsFile(certified, tmpdir+"/fields.pdf", fields, SignatureFieldsOptions{IgnoreDocMDP: true}); err != nil {
+			t.Errorf("%s: expected IgnoreDocMDP to add the fields, got %s", permission, err)
+		}
+	}
+}
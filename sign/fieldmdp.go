@@ -0,0 +1,75 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// checkFieldMDP checks the FieldMDP options of the signature.
+func (context *SignContext) checkFieldMDP() error {
+	signature := context.SignData.Signature
+
+	switch signature.FieldMDPAction {
+	case FieldMDPActionAll:
+		if len(signature.FieldMDPFields) > 0 {
+			return fmt.Errorf("FieldMDP fields require the Include or Exclude action")
+		}
+		return nil
+	case FieldMDPActionInclude, FieldMDPActionExclude:
+	default:
+		return fmt.Errorf("unknown FieldMDP action %d", signature.FieldMDPAction)
+	}
+
+	if signature.CertType != ApprovalSignature {
+		return fmt.Errorf("FieldMDP actions are only allowed for approval signatures")
+	}
+	if len(signature.FieldMDPFields) == 0 {
+		return fmt.Errorf("FieldMDP action requires at least one field")
+	}
+	for _, field := range signature.FieldMDPFields {
+		if field == "" {
+			return fmt.Errorf("FieldMDP field name can't be empty")
+		}
+	}
+
+	return nil
+}
+
+// writeFieldMDPAction writes the /Action and /Fields entries shared by the
+// FieldMDP transform parameters and the signature field lock dictionary
+// (Table 236), the field names are encrypted for the object.
+func (context *SignContext) writeFieldMDPAction(w *bytes.Buffer, object_id uint32, indent string) {
+	switch context.SignData.Signature.FieldMDPAction {
+	case FieldMDPActionInclude:
+		w.WriteString(indent + "/Action /Include\n")
+	case FieldMDPActionExclude:
+		w.WriteString(indent + "/Action /Exclude\n")
+	default:
+		w.WriteString(indent + "/Action /All\n")
+		return
+	}
+
+	w.WriteString(indent + "/Fields [")
+	for i, field := range context.SignData.Signature.FieldMDPFields {
+		if i > 0 {
+			w.WriteString(" ")
+		}
+		w.WriteString(context.encryptText(object_id, field))
+	}
+	w.WriteString("]\n")
+}
+
+// createLock returns the /Lock entry of a new signature field, it is only
+// written for the Include and Exclude actions.
+func (context *SignContext) createLock(object_id uint32) string {
+	if context.SignData.Signature.FieldMDPAction == FieldMDPActionAll {
+		return ""
+	}
+
+	var lock bytes.Buffer
+	lock.WriteString("  /Lock <<\n")
+	lock.WriteString("    /Type /SigFieldLock\n")
+	context.writeFieldMDPAction(&lock, object_id, "    ")
+	lock.WriteString("  >>\n")
+	return lock.String()
+}
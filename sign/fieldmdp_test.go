@@ -0,0 +1,110 @@
+package sign
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestSignFieldMDP(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input := createFormPDF(t)
+	tmpdir := t.TempDir()
+
+	signData := func(field string, action FieldMDPAction, fields ...string) SignData {
+		return SignData{
+			Signature: SignDataSignature{
+				CertType:       ApprovalSignature,
+				FieldMDPAction: action,
+				FieldMDPFields: fields,
+			},
+			FieldName:       field,
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+		}
+	}
+
+	// Each signer locks their own section of the form.
+	reviewed := tmpdir + "/reviewed.pdf"
+	if err := SignFile(input, reviewed, signData("reviewer", FieldMDPActionInclude, "name", "reviewer")); err != nil {
+		t.Fatalf("failed to sign existing field: %s", err)
+	}
+	approved := tmpdir + "/approved.pdf"
+	if err := SignFile(reviewed, approved, signData("", FieldMDPActionExclude, "name")); err != nil {
+		t.Fatalf("failed to sign new field: %s", err)
+	}
+
+	verifySignedBytes(t, mustReadFile(t, approved))
+
+	checkAction := func(name string, dict pdf.Value, action string, fields ...string) {
+		t.Helper()
+
+		if dict.Key("Action").Name() != action {
+			t.Errorf("%s: expected /Action /%s, got %s", name, action, dict.Key("Action"))
+		}
+		if dict.Key("Fields").Len() != len(fields) {
+			t.Fatalf("%s: expected %d fields, got %d", name, len(fields), dict.Key("Fields").Len())
+		}
+		for i, field := range fields {
+			if dict.Key("Fields").Index(i).Text() != field {
+				t.Errorf("%s: expected field %q, got %q", name, field, dict.Key("Fields").Index(i).Text())
+			}
+		}
+	}
+
+	fields := openPDF(t, approved).Trailer().Key("Root").Key("AcroForm").Key("Fields")
+
+	reviewer := fields.Index(1)
+	checkAction("reviewer signature", reviewer.Key("V").Key("TransformParams"), "Include", "name", "reviewer")
+	checkAction("reviewer lock", reviewer.Key("Lock"), "Include", "name", "reviewer")
+	if reviewer.Key("Lock").Key("Type").Name() != "SigFieldLock" {
+		t.Error("expected a SigFieldLock dictionary")
+	}
+
+	approver := fields.Index(3)
+	checkAction("new signature", approver.Key("V").Key("TransformParams"), "Exclude", "name")
+	checkAction("new lock", approver.Key("Lock"), "Exclude", "name")
+
+	// The default locks all fields without a lock dictionary.
+	signed := tmpdir + "/signed.pdf"
+	if err := SignFile(input, signed, signData("", FieldMDPActionAll)); err != nil {
+		t.Fatal(err)
+	}
+	field := openPDF(t, signed).Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(3)
+	checkAction("default signature", field.Key("V").Key("TransformParams"), "All")
+	if !field.Key("Lock").IsNull() {
+		t.Error("expected no lock dictionary for the All action")
+	}
+}
+
+func TestSignFieldMDPErrors(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tests := []struct {
+		name      string
+		signature SignDataSignature
+		err       string
+	}{
+		{"fields without action", SignDataSignature{CertType: ApprovalSignature, FieldMDPFields: []string{"name"}}, "Include or Exclude"},
+		{"action without fields", SignDataSignature{CertType: ApprovalSignature, FieldMDPAction: FieldMDPActionInclude}, "at least one field"},
+		{"empty field", SignDataSignature{CertType: ApprovalSignature, FieldMDPAction: FieldMDPActionExclude, FieldMDPFields: []string{""}}, "can't be empty"},
+		{"unknown action", SignDataSignature{CertType: ApprovalSignature, FieldMDPAction: 10, FieldMDPFields: []string{"name"}}, "unknown FieldMDP action"},
+		{"certification", SignDataSignature{CertType: CertificationSignature, DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms, FieldMDPAction: FieldMDPActionInclude, FieldMDPFields: []string{"name"}}, "only allowed for approval"},
+	}
+
+	for _, tt := range tests {
+		err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+			Signature:       tt.signature,
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
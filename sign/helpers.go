@@ -1,8 +1,6 @@
 package sign
 
 import (
-	"crypto"
-	"encoding/asn1"
 	"errors"
 	"fmt"
 	"io"
@@ -37,6 +35,12 @@ func findFirstPage(parent pdf.Value) (pdf.Value, error) {
 }
 
 func pdfString(text string) string {
+	return pdfLiteralString(encodeTextString(text))
+}
+
+// encodeTextString encodes a text string as PDFDocEncoding when possible,
+// otherwise as UTF-16BE with a byte order mark.
+func encodeTextString(text string) string {
 	if !isASCII(text) {
 		// UTF-16BE
 		enc := unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder()
@@ -44,7 +48,7 @@ func pdfString(text string) string {
 		if err != nil {
 			panic(err)
 		}
-		return "(" + res + ")"
+		return res
 	}
 
 	// UTF-8
@@ -55,16 +59,25 @@ func pdfString(text string) string {
 	// text = "<" + text + ">"
 
 	// PDFDocEncoded
-	text = strings.ReplaceAll(text, "\\", "\\\\")
-	text = strings.ReplaceAll(text, ")", "\\)")
-	text = strings.ReplaceAll(text, "(", "\\(")
-	text = strings.ReplaceAll(text, "\r", "\\r")
-	text = "(" + text + ")"
-
 	return text
 }
 
+// pdfLiteralString escapes the data as a literal string.
+func pdfLiteralString(data string) string {
+	data = strings.ReplaceAll(data, "\\", "\\\\")
+	data = strings.ReplaceAll(data, ")", "\\)")
+	data = strings.ReplaceAll(data, "(", "\\(")
+	data = strings.ReplaceAll(data, "\r", "\\r")
+
+	return "(" + data + ")"
+}
+
 func pdfDateTime(date time.Time) string {
+	return pdfString(pdfDate(date))
+}
+
+// pdfDate formats the date as a PDF date string without delimiters.
+func pdfDate(date time.Time) string {
 	// Calculate timezone offset from GMT.
 	_, original_offset := date.Zone()
 	offset := original_offset
@@ -90,7 +103,7 @@ func pdfDateTime(date time.Time) string {
 	offset_minutes_formatted := fmt.Sprintf("%d", offset_minutes)
 	dateString += leftPad(offset_hours_formatted, "0", 2-len(offset_hours_formatted)) + "'" + leftPad(offset_minutes_formatted, "0", 2-len(offset_minutes_formatted)) + "'"
 
-	return pdfString(dateString)
+	return dateString
 }
 
 func leftPad(s string, padStr string, pLen int) string {
@@ -162,31 +175,6 @@ func writePartFromSourceFileToTargetFile(input_file io.ReadSeeker, output_file i
 	return nil
 }
 
-var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
-	crypto.SHA1:   asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26}),
-	crypto.SHA256: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 1}),
-	crypto.SHA384: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 2}),
-	crypto.SHA512: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 3}),
-}
-
-// func getHashAlgorithmFromOID(target asn1.ObjectIdentifier) crypto.Hash {
-// 	for hash, oid := range hashOIDs {
-// 		if oid.Equal(target) {
-// 			return hash
-// 		}
-// 	}
-// 	return crypto.Hash(0)
-// }
-
-func getOIDFromHashAlgorithm(target crypto.Hash) asn1.ObjectIdentifier {
-	for hash, oid := range hashOIDs {
-		if hash == target {
-			return oid
-		}
-	}
-	return nil
-}
-
 func isASCII(s string) bool {
 	for _, r := range s {
 		if r > '\u007F' {
@@ -195,3 +183,54 @@ func isASCII(s string) bool {
 	}
 	return true
 }
+
+// readerAt implements io.ReaderAt for an io.ReadSeeker.
+type readerAt struct {
+	io.ReadSeeker
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// appendedReaderAt implements io.ReaderAt for the first size bytes of a file
+// followed by an incremental update held in memory.
+type appendedReaderAt struct {
+	io.ReaderAt
+	size   int64
+	update []byte
+}
+
+func (r appendedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < r.size {
+		length := min(int64(len(p)), r.size-off)
+		read, err := r.ReaderAt.ReadAt(p[:length], off)
+		n += read
+		if read < int(length) {
+			return n, err
+		}
+	}
+
+	if off+int64(n) >= r.size {
+		update_offset := off + int64(n) - r.size
+		if update_offset < int64(len(r.update)) {
+			n += copy(p[n:], r.update[update_offset:])
+		}
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
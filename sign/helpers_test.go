@@ -179,6 +179,33 @@ func TestWritePartFromSourceFileToTargetFile(t *testing.T) {
 	}
 }
 
+func TestAppendedReaderAt(t *testing.T) {
+	// Only the first 5 bytes of the input are used.
+	r := appendedReaderAt{bytes.NewReader([]byte("input ignored")), 5, []byte("update")}
+
+	tests := []struct {
+		offset   int64
+		length   int
+		expected string
+	}{
+		{0, 11, "inputupdate"},
+		{3, 4, "utup"},
+		{7, 4, "date"},
+		{9, 4, "te"},
+	}
+
+	for _, tt := range tests {
+		p := make([]byte, tt.length)
+		n, err := r.ReadAt(p, tt.offset)
+		if string(p[:n]) != tt.expected {
+			t.Errorf("ReadAt(%d, %d): expected %q, got %q", tt.offset, tt.length, tt.expected, p[:n])
+		}
+		if (n < tt.length) != (err != nil) {
+			t.Errorf("ReadAt(%d, %d): unexpected error %v", tt.offset, tt.length, err)
+		}
+	}
+}
+
 func loadHelpersTestPDF() (*os.File, *pdf.Reader) {
 	input_file, err := os.Open("../testfiles/testfile20.pdf")
 	if err != nil {
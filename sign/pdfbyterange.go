@@ -3,6 +3,7 @@ package sign
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strings"
 )
 
@@ -19,13 +20,13 @@ func (context *SignContext) updateByteRange() error {
 	}
 
 	// Calculate ByteRangeValues
-	signatureContentsStart := int64(contentsIndex) - 1
+	signatureContentsStart := context.inputSize + int64(contentsIndex) - 1
 	signatureContentsEnd := signatureContentsStart + int64(context.SignatureMaxLength) + 2
 	context.ByteRangeValues = []int64{
 		0,
 		signatureContentsStart,
 		signatureContentsEnd,
-		int64(context.OutputBuffer.Buff.Len()) - signatureContentsEnd,
+		context.inputSize + int64(context.OutputBuffer.Buff.Len()) - signatureContentsEnd,
 	}
 
 	new_byte_range := fmt.Sprintf("/ByteRange [%d %d %d %d]", context.ByteRangeValues[0], context.ByteRangeValues[1], context.ByteRangeValues[2], context.ByteRangeValues[3])
@@ -55,3 +56,61 @@ func (context *SignContext) updateByteRange() error {
 
 	return nil
 }
+
+// signContentReader returns a reader over the parts of the document covered by
+// the ByteRange, the input file followed by the incremental update up to and
+// after /Contents.
+func (context *SignContext) signContentReader() (io.Reader, error) {
+	contents_start := context.ByteRangeValues[1] - context.inputSize
+	contents_end := context.ByteRangeValues[2] - context.inputSize
+	if contents_start < 0 || contents_end > int64(context.OutputBuffer.Buff.Len()) {
+		return nil, fmt.Errorf("signature contents are not part of the incremental update")
+	}
+
+	update := context.OutputBuffer.Buff.Bytes()
+
+	return io.MultiReader(
+		io.NewSectionReader(context.inputReaderAt(), 0, context.inputSize),
+		bytes.NewReader(update[:contents_start]),
+		bytes.NewReader(update[contents_end:]),
+	), nil
+}
+
+// hashSignContent returns the digest of the parts of the document covered by
+// the ByteRange.
+func (context *SignContext) hashSignContent() ([]byte, error) {
+	r, err := context.signContentReader()
+	if err != nil {
+		return nil, err
+	}
+
+	h := context.SignData.DigestAlgorithm.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to hash byte range: %w", err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// inputReaderAt returns the input file as io.ReaderAt.
+func (context *SignContext) inputReaderAt() io.ReaderAt {
+	if r, ok := context.InputFile.(io.ReaderAt); ok {
+		return r
+	}
+
+	return readerAt{context.InputFile}
+}
+
+// writeOutput writes the input file followed by the incremental update to the
+// output file.
+func (context *SignContext) writeOutput() error {
+	if _, err := io.Copy(context.OutputFile, io.NewSectionReader(context.inputReaderAt(), 0, context.inputSize)); err != nil {
+		return err
+	}
+
+	if _, err := context.OutputFile.Write(context.OutputBuffer.Buff.Bytes()); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -10,6 +10,26 @@ import (
 )
 
 func (context *SignContext) createCatalog() ([]byte, error) {
+	var sig_flags int
+	switch context.SignData.Signature.CertType {
+	case CertificationSignature, ApprovalSignature, TimeStampSignature:
+		sig_flags = 3
+	case UsageRightsSignature:
+		sig_flags = 1
+	}
+
+	var new_fields []uint32
+	if context.SignData.FieldName == "" {
+		// A signed existing field is already part of the form.
+		new_fields = append(new_fields, context.VisualSignData.objectId)
+	}
+
+	return context.createFormCatalog(new_fields, sig_flags)
+}
+
+// createFormCatalog creates a copy of the catalog with the new fields appended
+// to the existing AcroForm.
+func (context *SignContext) createFormCatalog(new_fields []uint32, sig_flags int) ([]byte, error) {
 	var catalog_buffer bytes.Buffer
 
 	// Start the catalog object
@@ -33,40 +53,75 @@ func (context *SignContext) createCatalog() ([]byte, error) {
 		catalog_buffer.WriteString("  /Version /1.5\n")
 	}
 
+	// The catalog is added as the next object.
+	catalog_id := context.getNextObjectID()
+
 	// Retrieve the root, its pointer and set the root string
 	root := context.PDFReader.Trailer().Key("Root")
 	rootPtr := root.GetPtr()
 	context.CatalogData.RootString = strconv.Itoa(int(rootPtr.GetID())) + " " + strconv.Itoa(int(rootPtr.GetGen())) + " R"
 
+	// A certification or usage rights signature is referenced from the
+	// /Perms dictionary, it replaces an existing entry of the same type.
+	var perms_key string
+	switch context.SignData.Signature.CertType {
+	case CertificationSignature:
+		perms_key = "DocMDP"
+	case UsageRightsSignature:
+		perms_key = "UR3"
+	}
+
 	// Copy over existing catalog entries except for type and AcroForum
 	for _, key := range root.Keys() {
-		if key != "Type" && key != "AcroForm" {
+		if key != "Type" && key != "AcroForm" && (key != "Perms" || perms_key == "") {
 			_, _ = fmt.Fprintf(&catalog_buffer, "  /%s ", key)
-			context.serializeCatalogEntry(&catalog_buffer, rootPtr.GetID(), root.Key(key))
+			context.serializeCatalogEntry(&catalog_buffer, catalog_id, rootPtr.GetID(), root.Key(key))
 			catalog_buffer.WriteString("\n")
 		}
 	}
 
+	if perms_key != "" {
+		context.writePerms(&catalog_buffer, catalog_id, root.Key("Perms"), perms_key)
+	}
+
 	// Start the AcroForm dictionary with /NeedAppearances
 	catalog_buffer.WriteString("  /AcroForm <<\n")
+
+	acroForm := root.Key("AcroForm")
+	acroFormPtr := acroForm.GetPtr()
+
+	// Keep all existing fields, including non-signature fields, and append
+	// the new fields.
 	catalog_buffer.WriteString("    /Fields [")
 
-	// Add existing signatures to the AcroForm dictionary
-	for i, sig := range context.existingSignatures {
+	fields := acroForm.Key("Fields")
+	fieldsPtr := fields.GetPtr()
+	for i := 0; i < fields.Len(); i++ {
 		if i > 0 {
 			catalog_buffer.WriteString(" ")
 		}
-		catalog_buffer.WriteString(strconv.Itoa(int(sig.objectId)) + " 0 R")
+		context.serializeCatalogEntry(&catalog_buffer, catalog_id, fieldsPtr.GetID(), fields.Index(i))
 	}
 
-	// Add the visual signature field to the AcroForm dictionary
-	if len(context.existingSignatures) > 0 {
-		catalog_buffer.WriteString(" ")
+	for i, field := range new_fields {
+		if i > 0 || fields.Len() > 0 {
+			catalog_buffer.WriteString(" ")
+		}
+		catalog_buffer.WriteString(strconv.Itoa(int(field)) + " 0 R")
 	}
-	catalog_buffer.WriteString(strconv.Itoa(int(context.VisualSignData.objectId)) + " 0 R")
 
 	catalog_buffer.WriteString("]\n") // close Fields array
 
+	// Copy over the other existing AcroForm entries, such as /DA, /DR,
+	// /NeedAppearances, /XFA and /CO.
+	for _, key := range acroForm.Keys() {
+		if key != "Fields" && key != "SigFlags" {
+			_, _ = fmt.Fprintf(&catalog_buffer, "    /%s ", key)
+			context.serializeCatalogEntry(&catalog_buffer, catalog_id, acroFormPtr.GetID(), acroForm.Key(key))
+			catalog_buffer.WriteString("\n")
+		}
+	}
+
 	// (Optional; deprecated in PDF 2.0) A flag specifying whether
 	// to construct appearance streams and appearance
 	// dictionaries for all widget annotations in the document (see
@@ -100,12 +155,10 @@ func (context *SignContext) createCatalog() ([]byte, error) {
 	// require explicit confirmation before continuing with the
 	// operation.
 	//
-	// Set SigFlags and Permissions based on Signature Type
-	switch context.SignData.Signature.CertType {
-	case CertificationSignature, ApprovalSignature, TimeStampSignature:
-		catalog_buffer.WriteString("    /SigFlags 3\n")
-	case UsageRightsSignature:
-		catalog_buffer.WriteString("    /SigFlags 1\n")
+	// The flags are set based on the signature type, existing flags are kept.
+	sig_flags |= int(acroForm.Key("SigFlags").Int64())
+	if sig_flags != 0 {
+		_, _ = fmt.Fprintf(&catalog_buffer, "    /SigFlags %d\n", sig_flags)
 	}
 
 	// Finalize the AcroForm and Catalog object
@@ -115,8 +168,31 @@ func (context *SignContext) createCatalog() ([]byte, error) {
 	return catalog_buffer.Bytes(), nil
 }
 
+// writePerms writes the permissions dictionary (Table 263) with the signature
+// as the perms_key entry, the other existing entries are kept.
+func (context *SignContext) writePerms(w *bytes.Buffer, catalog_id uint32, perms pdf.Value, perms_key string) {
+	permsPtr := perms.GetPtr()
+
+	w.WriteString("  /Perms <<")
+	for _, key := range perms.Keys() {
+		if key == perms_key {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, " /%s ", key)
+		context.serializeCatalogEntry(w, catalog_id, permsPtr.GetID(), perms.Key(key))
+	}
+
+	// DocMDP [dictionary]: (Optional) An indirect reference to a signature
+	//   dictionary containing a DocMDP transform method (see 12.8.2.2).
+	// UR3 [dictionary]: (Optional; deprecated in PDF 2.0) A signature
+	//   dictionary that shall be used to specify and validate additional
+	//   capabilities (usage rights) granted for this document.
+	_, _ = fmt.Fprintf(w, " /%s %d 0 R >>\n", perms_key, context.SignData.objectId)
+}
+
 // serializeCatalogEntry takes a pdf.Value and serializes it to the given writer.
-func (context *SignContext) serializeCatalogEntry(w io.Writer, rootObjId uint32, value pdf.Value) {
+// Strings are encrypted for objectId, the object the value is written to.
+func (context *SignContext) serializeCatalogEntry(w io.Writer, objectId uint32, rootObjId uint32, value pdf.Value) {
 	if ptr := value.GetPtr(); ptr.GetID() != rootObjId {
 		// Indirect object
 		_, _ = fmt.Fprintf(w, "%d %d R", ptr.GetID(), ptr.GetGen())
@@ -126,7 +202,7 @@ func (context *SignContext) serializeCatalogEntry(w io.Writer, rootObjId uint32,
 	// Direct object
 	switch value.Kind() {
 	case pdf.String:
-		_, _ = fmt.Fprintf(w, "(%s)", value.RawString())
+		_, _ = fmt.Fprint(w, context.encryptString(objectId, value.RawString()))
 	case pdf.Null:
 		_, _ = fmt.Fprint(w, "null")
 	case pdf.Bool:
@@ -148,7 +224,7 @@ func (context *SignContext) serializeCatalogEntry(w io.Writer, rootObjId uint32,
 				_, _ = fmt.Fprint(w, " ") // Space between items
 			}
 			_, _ = fmt.Fprintf(w, "/%s ", key)
-			context.serializeCatalogEntry(w, rootObjId, value.Key(key))
+			context.serializeCatalogEntry(w, objectId, rootObjId, value.Key(key))
 		}
 		_, _ = fmt.Fprint(w, ">>")
 	case pdf.Array:
@@ -157,7 +233,7 @@ func (context *SignContext) serializeCatalogEntry(w io.Writer, rootObjId uint32,
 			if idx > 0 {
 				_, _ = fmt.Fprint(w, " ") // Space between items
 			}
-			context.serializeCatalogEntry(w, rootObjId, value.Index(idx))
+			context.serializeCatalogEntry(w, objectId, rootObjId, value.Index(idx))
 		}
 		_, _ = fmt.Fprint(w, "]")
 	case pdf.Stream:
@@ -1,11 +1,13 @@
 package sign
 
 import (
+	"crypto"
 	"fmt"
 	"os"
 	"testing"
 
 	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
 )
 
 var testFiles = []struct {
@@ -15,16 +17,16 @@ var testFiles = []struct {
 	{
 		file: "../testfiles/testfile20.pdf",
 		expectedCatalogs: map[CertType]string{
-			CertificationSignature: "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 3\n  >>\n>>\n",
-			UsageRightsSignature:   "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 1\n  >>\n>>\n",
+			CertificationSignature: "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /Perms << /DocMDP 9 0 R >>\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 3\n  >>\n>>\n",
+			UsageRightsSignature:   "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /Perms << /UR3 9 0 R >>\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 1\n  >>\n>>\n",
 			ApprovalSignature:      "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 3\n  >>\n>>\n",
 		},
 	},
 	{
 		file: "../testfiles/testfile12.pdf",
 		expectedCatalogs: map[CertType]string{
-			CertificationSignature: "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 3\n  >>\n>>\n",
-			UsageRightsSignature:   "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 1\n  >>\n>>\n",
+			CertificationSignature: "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /Perms << /DocMDP 15 0 R >>\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 3\n  >>\n>>\n",
+			UsageRightsSignature:   "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /Perms << /UR3 15 0 R >>\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 1\n  >>\n>>\n",
 			ApprovalSignature:      "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 3\n  >>\n>>\n",
 		},
 	},
@@ -64,6 +66,7 @@ func TestCreateCatalog(t *testing.T) {
 							CertType:   certType,
 							DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
 						},
+						objectId: uint32(rdr.XrefInformation.ItemCount) - 1,
 					},
 				}
 
@@ -80,3 +83,71 @@ func TestCreateCatalog(t *testing.T) {
 		}
 	}
 }
+
+func TestSignCatalogPerms(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tmpdir := t.TempDir()
+
+	sign := func(input, output string, cert_type CertType) {
+		t.Helper()
+
+		err := SignFile(input, output, SignData{
+			Signature: SignDataSignature{
+				CertType:   cert_type,
+				DocMDPPerm: DoNotAllowAnyChangesPerms,
+			},
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+			IgnoreDocMDP:    true,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign: %s", err)
+		}
+	}
+
+	certificationLevel := func(path string) int {
+		t.Helper()
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		response, err := verify.VerifyFile(file)
+		if err != nil {
+			t.Fatalf("failed to verify: %s", err)
+		}
+		return response.DocumentInfo.CertificationLevel
+	}
+
+	approved := tmpdir + "/approved.pdf"
+	sign("../testfiles/testfile20.pdf", approved, ApprovalSignature)
+	if !openPDF(t, approved).Trailer().Key("Root").Key("Perms").IsNull() {
+		t.Error("expected no /Perms for an approval signature")
+	}
+	if level := certificationLevel(approved); level != 0 {
+		t.Errorf("expected an uncertified document, got level %d", level)
+	}
+
+	usage_rights := tmpdir + "/usage_rights.pdf"
+	sign("../testfiles/testfile20.pdf", usage_rights, UsageRightsSignature)
+
+	// The usage rights signature is kept next to the certification.
+	certified := tmpdir + "/certified.pdf"
+	sign(usage_rights, certified, CertificationSignature)
+
+	perms := openPDF(t, certified).Trailer().Key("Root").Key("Perms")
+	if perms.Key("UR3").Key("Reference").Index(0).Key("TransformMethod").Name() != "UR3" {
+		t.Error("expected /Perms /UR3 to reference the usage rights signature")
+	}
+	if perms.Key("DocMDP").Key("Reference").Index(0).Key("TransformMethod").Name() != "DocMDP" {
+		t.Error("expected /Perms /DocMDP to reference the certification signature")
+	}
+	if level := certificationLevel(certified); level != int(DoNotAllowAnyChangesPerms) {
+		t.Errorf("expected certification level 1, got %d", level)
+	}
+}
@@ -0,0 +1,478 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
+	"github.com/mattetti/filebuffer"
+)
+
+// DSSData contains the validation material that is written to the Document
+// Security Store (ETSI EN 319 142-1, 5.4.2) in addition to the material found
+// in the existing signatures of the document.
+type DSSData struct {
+	Certificates []*x509.Certificate
+	OCSPs        [][]byte
+	CRLs         [][]byte
+
+	// RevocationFunction is called for every certificate found in the
+	// existing signatures to retrieve fresh revocation data.
+	RevocationFunction RevocationFunction
+}
+
+// dssSignature holds the validation material related to a single signature,
+// it becomes a /VRI entry in the Document Security Store.
+type dssSignature struct {
+	key          string
+	certificates [][]byte
+	ocsps        [][]byte
+	crls         [][]byte
+}
+
+// dssEntries holds the object references of a Document Security Store or VRI
+// dictionary.
+type dssEntries struct {
+	certs []string
+	ocsps []string
+	crls  []string
+}
+
+// AddDSSFile adds a Document Security Store to the input file as an
+// incremental update.
+func AddDSSFile(input string, output string, dss DSSData) error {
+	input_file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	output_file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output_file.Close()
+	}()
+
+	finfo, err := input_file.Stat()
+	if err != nil {
+		return err
+	}
+	size := finfo.Size()
+
+	rdr, err := pdf.NewReader(input_file, size)
+	if err != nil {
+		return err
+	}
+
+	return AddDSS(input_file, output_file, rdr, size, dss)
+}
+
+// AddDSS writes a /DSS dictionary into the document catalog as an incremental
+// update. The dictionary contains the certificates, OCSP responses and CRLs of
+// all existing signatures and document timestamps together with a /VRI entry
+// for each of them. Entries of an existing Document Security Store are kept,
+// so existing signatures remain valid.
+func AddDSS(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, dss DSSData) error {
+	context := SignContext{
+		PDFReader:  rdr,
+		InputFile:  input,
+		OutputFile: output,
+		inputSize:  size,
+	}
+
+	return context.AddDSS(dss)
+}
+
+func (context *SignContext) AddDSS(dss DSSData) error {
+	if err := context.createDSSUpdate(dss); err != nil {
+		return err
+	}
+
+	return context.writeOutput()
+}
+
+// createDSSUpdate creates the incremental update with the Document Security
+// Store in the output buffer.
+func (context *SignContext) createDSSUpdate(dss DSSData) error {
+	if isEncrypted(context.PDFReader) {
+		return &UnsupportedEncryptionError{Reason: "adding a DSS to an encrypted document"}
+	}
+
+	// The buffer only holds the incremental update.
+	context.OutputBuffer = filebuffer.New([]byte{})
+
+	// File always needs an empty line after %%EOF.
+	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
+		return err
+	}
+
+	signatures, err := context.fetchSignatureValidationData(dss.RevocationFunction)
+	if err != nil {
+		return fmt.Errorf("failed to fetch validation data: %w", err)
+	}
+
+	dss_object, err := context.createDSS(dss, signatures)
+	if err != nil {
+		return fmt.Errorf("failed to create DSS: %w", err)
+	}
+
+	dss_object_id, err := context.addObject(dss_object)
+	if err != nil {
+		return fmt.Errorf("failed to add DSS object: %w", err)
+	}
+
+	catalog, err := context.createDSSCatalog(dss_object_id)
+	if err != nil {
+		return fmt.Errorf("failed to create catalog: %w", err)
+	}
+
+	context.CatalogData.ObjectId, err = context.addObject(catalog)
+	if err != nil {
+		return fmt.Errorf("failed to add catalog object: %w", err)
+	}
+
+	if err := context.writeXref(); err != nil {
+		return fmt.Errorf("failed to write xref: %w", err)
+	}
+
+	if err := context.writeTrailer(); err != nil {
+		return fmt.Errorf("failed to write trailer: %w", err)
+	}
+
+	return nil
+}
+
+// fetchSignatureValidationData collects the certificates and revocation data
+// of all signatures and document timestamps in the document.
+func (context *SignContext) fetchSignatureValidationData(revocation_function RevocationFunction) ([]dssSignature, error) {
+	var signatures []dssSignature
+
+	for _, x := range context.PDFReader.Xref() {
+		ptr := x.Ptr()
+		v := context.PDFReader.Resolve(ptr, ptr)
+		if v.Key("Filter").Name() != "Adobe.PPKLite" {
+			continue
+		}
+
+		contents := []byte(v.Key("Contents").RawString())
+		if len(contents) == 0 {
+			continue
+		}
+
+		// The VRI key is the uppercase base-16 encoded SHA-1 digest of the
+		// signature value, the complete /Contents string.
+		key := sha1.Sum(contents)
+		signature := dssSignature{
+			key: strings.ToUpper(hex.EncodeToString(key[:])),
+		}
+
+		p7, err := pkcs7.Parse(contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signature %d: %w", ptr.GetID(), err)
+		}
+
+		certificates := p7.Certificates
+
+		// Include the certificates of an embedded signature timestamp.
+		for _, signer := range p7.Signers {
+			for _, attribute := range signer.UnauthenticatedAttributes {
+				if !attribute.Type.Equal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}) {
+					continue
+				}
+
+				token, err := pkcs7.Parse(attribute.Value.Bytes)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse timestamp token of signature %d: %w", ptr.GetID(), err)
+				}
+				certificates = append(certificates, token.Certificates...)
+			}
+		}
+
+		for _, certificate := range certificates {
+			signature.certificates = append(signature.certificates, certificate.Raw)
+		}
+
+		// Revocation data embedded in the signature.
+		var info revocation.InfoArchival
+		_ = p7.UnmarshalSignedAttribute(asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}, &info)
+
+		if revocation_function != nil {
+			for _, certificate := range certificates {
+				// Self-signed certificates have no revocation status.
+				if bytes.Equal(certificate.RawIssuer, certificate.RawSubject) {
+					continue
+				}
+
+				var issuer *x509.Certificate
+				for _, candidate := range certificates {
+					if bytes.Equal(certificate.RawIssuer, candidate.RawSubject) {
+						issuer = candidate
+						break
+					}
+				}
+
+				if err := revocation_function(certificate, issuer, &info); err != nil {
+					return nil, fmt.Errorf("failed to fetch revocation data for %s: %w", certificate.Subject, err)
+				}
+			}
+		}
+
+		for _, ocsp := range info.OCSP {
+			signature.ocsps = append(signature.ocsps, ocsp.FullBytes)
+		}
+		for _, crl := range info.CRL {
+			signature.crls = append(signature.crls, crl.FullBytes)
+		}
+
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, nil
+}
+
+// createDSS writes the validation material as stream objects and returns the
+// Document Security Store dictionary referencing them.
+func (context *SignContext) createDSS(dss DSSData, signatures []dssSignature) ([]byte, error) {
+	existing_dss := context.PDFReader.Trailer().Key("Root").Key("DSS")
+
+	// Object references by SHA-256 digest of the stream data, used to avoid
+	// writing the same certificate or response twice.
+	streams := map[[32]byte]string{}
+
+	var entries dssEntries
+	if !existing_dss.IsNull() {
+		var err error
+		entries.certs, err = existingDSSStreams(existing_dss.Key("Certs"), streams)
+		if err != nil {
+			return nil, err
+		}
+		entries.ocsps, err = existingDSSStreams(existing_dss.Key("OCSPs"), streams)
+		if err != nil {
+			return nil, err
+		}
+		entries.crls, err = existingDSSStreams(existing_dss.Key("CRLs"), streams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var certificates [][]byte
+	for _, certificate := range dss.Certificates {
+		certificates = append(certificates, certificate.Raw)
+	}
+
+	if err := context.addDSSStreams(&entries.certs, certificates, streams); err != nil {
+		return nil, err
+	}
+	if err := context.addDSSStreams(&entries.ocsps, dss.OCSPs, streams); err != nil {
+		return nil, err
+	}
+	if err := context.addDSSStreams(&entries.crls, dss.CRLs, streams); err != nil {
+		return nil, err
+	}
+
+	vri := map[string]dssEntries{}
+	for _, signature := range signatures {
+		var signature_entries dssEntries
+
+		// Keep the references of an existing VRI entry for this signature.
+		existing_vri := existing_dss.Key("VRI").Key(signature.key)
+		if !existing_vri.IsNull() {
+			signature_entries.certs = existingDSSReferences(existing_vri.Key("Cert"))
+			signature_entries.ocsps = existingDSSReferences(existing_vri.Key("OCSP"))
+			signature_entries.crls = existingDSSReferences(existing_vri.Key("CRL"))
+		}
+
+		if err := context.addDSSStreams(&signature_entries.certs, signature.certificates, streams); err != nil {
+			return nil, err
+		}
+		if err := context.addDSSStreams(&signature_entries.ocsps, signature.ocsps, streams); err != nil {
+			return nil, err
+		}
+		if err := context.addDSSStreams(&signature_entries.crls, signature.crls, streams); err != nil {
+			return nil, err
+		}
+
+		for _, ref := range signature_entries.certs {
+			entries.certs = appendReference(entries.certs, ref)
+		}
+		for _, ref := range signature_entries.ocsps {
+			entries.ocsps = appendReference(entries.ocsps, ref)
+		}
+		for _, ref := range signature_entries.crls {
+			entries.crls = appendReference(entries.crls, ref)
+		}
+
+		vri[signature.key] = signature_entries
+	}
+
+	var dss_buffer bytes.Buffer
+
+	dss_buffer.WriteString("<<\n")
+	dss_buffer.WriteString("  /Type /DSS\n")
+	writeDSSArray(&dss_buffer, "  ", "Certs", entries.certs)
+	writeDSSArray(&dss_buffer, "  ", "OCSPs", entries.ocsps)
+	writeDSSArray(&dss_buffer, "  ", "CRLs", entries.crls)
+
+	dss_buffer.WriteString("  /VRI <<\n")
+
+	// Copy VRI entries of signatures that are no longer found, such as
+	// signatures in a previous revision.
+	existing_vri := existing_dss.Key("VRI")
+	existing_vri_ptr := existing_vri.GetPtr()
+	for _, key := range existing_vri.Keys() {
+		if _, ok := vri[key]; ok {
+			continue
+		}
+		_, _ = fmt.Fprintf(&dss_buffer, "    /%s ", key)
+		context.serializeCatalogEntry(&dss_buffer, context.getNextObjectID(), existing_vri_ptr.GetID(), existing_vri.Key(key))
+		dss_buffer.WriteString("\n")
+	}
+
+	keys := make([]string, 0, len(vri))
+	for key := range vri {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(&dss_buffer, "    /%s <<\n", key)
+		writeDSSArray(&dss_buffer, "      ", "Cert", vri[key].certs)
+		writeDSSArray(&dss_buffer, "      ", "OCSP", vri[key].ocsps)
+		writeDSSArray(&dss_buffer, "      ", "CRL", vri[key].crls)
+		dss_buffer.WriteString("    >>\n")
+	}
+
+	dss_buffer.WriteString("  >>\n") // Close VRI
+	dss_buffer.WriteString(">>\n")   // Close DSS
+
+	return dss_buffer.Bytes(), nil
+}
+
+// addDSSStreams writes the data as stream objects and appends their references.
+func (context *SignContext) addDSSStreams(refs *[]string, data [][]byte, streams map[[32]byte]string) error {
+	for _, d := range data {
+		digest := sha256.Sum256(d)
+
+		ref, ok := streams[digest]
+		if !ok {
+			var stream_buffer bytes.Buffer
+			_, _ = fmt.Fprintf(&stream_buffer, "<< /Length %d >>\n", len(d))
+			stream_buffer.WriteString("stream\n")
+			stream_buffer.Write(d)
+			stream_buffer.WriteString("\nendstream\n")
+
+			id, err := context.addObject(stream_buffer.Bytes())
+			if err != nil {
+				return fmt.Errorf("failed to add DSS stream: %w", err)
+			}
+
+			ref = strconv.Itoa(int(id)) + " 0 R"
+			streams[digest] = ref
+		}
+
+		*refs = appendReference(*refs, ref)
+	}
+
+	return nil
+}
+
+// existingDSSStreams returns the references of the streams in an existing DSS
+// array and registers their digest.
+func existingDSSStreams(array pdf.Value, streams map[[32]byte]string) ([]string, error) {
+	var refs []string
+
+	for i := 0; i < array.Len(); i++ {
+		stream := array.Index(i)
+		ptr := stream.GetPtr()
+		ref := fmt.Sprintf("%d %d R", ptr.GetID(), ptr.GetGen())
+
+		reader := stream.Reader()
+		data, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DSS stream %s: %w", ref, err)
+		}
+
+		streams[sha256.Sum256(data)] = ref
+		refs = appendReference(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// existingDSSReferences returns the references in an existing VRI array.
+func existingDSSReferences(array pdf.Value) []string {
+	var refs []string
+
+	for i := 0; i < array.Len(); i++ {
+		ptr := array.Index(i).GetPtr()
+		refs = appendReference(refs, fmt.Sprintf("%d %d R", ptr.GetID(), ptr.GetGen()))
+	}
+
+	return refs
+}
+
+func appendReference(refs []string, ref string) []string {
+	for _, r := range refs {
+		if r == ref {
+			return refs
+		}
+	}
+
+	return append(refs, ref)
+}
+
+func writeDSSArray(w *bytes.Buffer, indent string, key string, refs []string) {
+	if len(refs) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%s/%s [%s]\n", indent, key, strings.Join(refs, " "))
+}
+
+// createDSSCatalog creates a copy of the catalog that references the new
+// Document Security Store.
+func (context *SignContext) createDSSCatalog(dss_object_id uint32) ([]byte, error) {
+	var catalog_buffer bytes.Buffer
+
+	catalog_buffer.WriteString("<<\n")
+	catalog_buffer.WriteString("  /Type /Catalog\n")
+
+	// The catalog is added as the next object.
+	catalog_id := context.getNextObjectID()
+
+	root := context.PDFReader.Trailer().Key("Root")
+	rootPtr := root.GetPtr()
+	context.CatalogData.RootString = strconv.Itoa(int(rootPtr.GetID())) + " " + strconv.Itoa(int(rootPtr.GetGen())) + " R"
+
+	// Copy over existing catalog entries except for type and DSS
+	for _, key := range root.Keys() {
+		if key != "Type" && key != "DSS" {
+			_, _ = fmt.Fprintf(&catalog_buffer, "  /%s ", key)
+			context.serializeCatalogEntry(&catalog_buffer, catalog_id, rootPtr.GetID(), root.Key(key))
+			catalog_buffer.WriteString("\n")
+		}
+	}
+
+	_, _ = fmt.Fprintf(&catalog_buffer, "  /DSS %d 0 R\n", dss_object_id)
+	catalog_buffer.WriteString(">>\n")
+
+	return catalog_buffer.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+)
+
+func TestAddDSS(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tmpdir := t.TempDir()
+	signedFile := tmpdir + "/signed.pdf"
+	dssFile := tmpdir + "/dss.pdf"
+	dssTwiceFile := tmpdir + "/dss_twice.pdf"
+
+	err := SignFile("../testfiles/testfile20.pdf", signedFile, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+			PAdES:    true,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err.Error())
+	}
+
+	revocationCalls := 0
+	err = AddDSSFile(signedFile, dssFile, DSSData{
+		CRLs: [][]byte{[]byte("crl")},
+		RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+			revocationCalls++
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to add DSS: %s", err.Error())
+	}
+	if revocationCalls != 0 {
+		t.Errorf("expected no revocation calls for a self-signed certificate, got %d", revocationCalls)
+	}
+
+	dss := readDSS(t, dssFile)
+	if dss.Key("Certs").Len() != 1 {
+		t.Errorf("expected 1 certificate, got %d", dss.Key("Certs").Len())
+	}
+	if dss.Key("CRLs").Len() != 1 {
+		t.Errorf("expected 1 CRL, got %d", dss.Key("CRLs").Len())
+	}
+	if len(dss.Key("VRI").Keys()) != 1 {
+		t.Fatalf("expected 1 VRI entry, got %d", len(dss.Key("VRI").Keys()))
+	}
+	vri := dss.Key("VRI").Key(dss.Key("VRI").Keys()[0])
+	if vri.Key("Cert").Len() != 1 {
+		t.Errorf("expected 1 VRI certificate, got %d", vri.Key("Cert").Len())
+	}
+
+	// The existing signature must remain valid.
+	output, err := os.Open(dssFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = output.Close()
+	}()
+	verifySignedFile(t, output, "testfile20.pdf")
+
+	// Adding the DSS again must not duplicate the existing entries.
+	if err := AddDSSFile(dssFile, dssTwiceFile, DSSData{}); err != nil {
+		t.Fatalf("failed to add DSS twice: %s", err.Error())
+	}
+
+	dss = readDSS(t, dssTwiceFile)
+	if dss.Key("Certs").Len() != 1 {
+		t.Errorf("expected 1 certificate, got %d", dss.Key("Certs").Len())
+	}
+	if dss.Key("CRLs").Len() != 1 {
+		t.Errorf("expected 1 CRL, got %d", dss.Key("CRLs").Len())
+	}
+	if len(dss.Key("VRI").Keys()) != 1 {
+		t.Errorf("expected 1 VRI entry, got %d", len(dss.Key("VRI").Keys()))
+	}
+}
+
+func readDSS(t *testing.T, path string) pdf.Value {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+
+	finfo, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := pdf.NewReader(file, finfo.Size())
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err.Error())
+	}
+
+	dss := rdr.Trailer().Key("Root").Key("DSS")
+	if dss.IsNull() {
+		t.Fatalf("no DSS in %s", path)
+	}
+
+	return dss
+}
@@ -0,0 +1,85 @@
+package sign
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/pdfcrypt"
+)
+
+// ErrInvalidPassword is returned when the password doesn't open an encrypted
+// document.
+var ErrInvalidPassword = pdfcrypt.ErrInvalidPassword
+
+// UnsupportedEncryptionError is returned for encrypted documents that can't be
+// signed, such as documents with an unknown security handler.
+type UnsupportedEncryptionError = pdfcrypt.UnsupportedEncryptionError
+
+// NewReader opens a PDF document for signing. Encrypted documents are opened
+// with password, which may be the user or the owner password.
+func NewReader(input io.ReaderAt, size int64, password string) (*pdf.Reader, error) {
+	return pdfcrypt.NewReader(input, size, password)
+}
+
+// isEncrypted reports whether the document is encrypted.
+func isEncrypted(rdr *pdf.Reader) bool {
+	return pdfcrypt.IsEncrypted(rdr)
+}
+
+// initEncryption sets up the security handler for encrypted documents.
+func (context *SignContext) initEncryption(password string) error {
+	if !isEncrypted(context.PDFReader) {
+		return nil
+	}
+
+	reader_at, ok := context.InputFile.(io.ReaderAt)
+	if !ok {
+		reader_at = readerAt{context.InputFile}
+	}
+
+	encrypt, id, err := pdfcrypt.ReadEncryptionDictionary(reader_at, context.inputSize)
+	if err != nil {
+		return fmt.Errorf("failed to read encryption dictionary: %w", err)
+	}
+
+	context.encryption, err = pdfcrypt.NewSecurityHandler(encrypt, id, password)
+	if err != nil {
+		return err
+	}
+
+	// A direct encryption dictionary has the pointer of the trailer.
+	encrypt_ptr := encrypt.GetPtr()
+	trailer_ptr := context.PDFReader.Trailer().GetPtr()
+	if encrypt_ptr.GetID() != trailer_ptr.GetID() {
+		context.encryption.ObjectID = encrypt_ptr.GetID()
+		context.encryption.Generation = encrypt_ptr.GetGen()
+	}
+
+	return nil
+}
+
+// encryptString returns the PDF string of the data encrypted for the object,
+// or the literal string when the document isn't encrypted.
+func (context *SignContext) encryptString(object_id uint32, data string) string {
+	if context.encryption == nil {
+		return pdfLiteralString(data)
+	}
+
+	return "<" + hex.EncodeToString(context.encryption.EncryptString(object_id, []byte(data))) + ">"
+}
+
+// encryptText returns the PDF string of a text string, see encryptString.
+func (context *SignContext) encryptText(object_id uint32, text string) string {
+	return context.encryptString(object_id, encodeTextString(text))
+}
+
+// encryptStream returns the stream data encrypted for the object.
+func (context *SignContext) encryptStream(object_id uint32, data []byte) []byte {
+	if context.encryption == nil {
+		return data
+	}
+
+	return context.encryption.EncryptStream(object_id, data)
+}
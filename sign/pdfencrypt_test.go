@@ -0,0 +1,179 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pkcs7"
+)
+
+// encryptedFixtures are documents encrypted by testfiles/encrypted/generate.py
+// with the user password "user" and the owner password "owner".
+// aes-256-owner.pdf only has the owner password.
+var encryptedFixtures = []string{"rc4-40", "rc4-128", "rc4-128-cf", "aes-128", "aes-256", "aes-256-owner"}
+
+const fixtureLastModified = "D:20240101000000Z"
+
+var byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+
+// verifySignatureBytes checks the last signature of the document against its
+// byte range, the strings of the signature dictionary of an encrypted
+// document can't be read by the verify package.
+func verifySignatureBytes(t *testing.T, signed []byte) {
+	t.Helper()
+
+	matches := byteRangePattern.FindAllSubmatch(signed, -1)
+	if len(matches) == 0 {
+		t.Fatal("signature byte range not found")
+	}
+
+	var byte_range [4]int
+	for i := range byte_range {
+		byte_range[i], _ = strconv.Atoi(string(matches[len(matches)-1][i+1]))
+	}
+
+	contents, err := hex.DecodeString(string(signed[byte_range[1]+1 : byte_range[2]-1]))
+	if err != nil {
+		t.Fatalf("failed to decode signature contents: %s", err)
+	}
+
+	p7, err := pkcs7.Parse(bytes.TrimRight(contents, "\x00"))
+	if err != nil {
+		t.Fatalf("failed to parse signature: %s", err)
+	}
+
+	p7.Content = append(append([]byte{}, signed[byte_range[0]:byte_range[0]+byte_range[1]]...), signed[byte_range[2]:byte_range[2]+byte_range[3]]...)
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("signature verification failed: %s", err)
+	}
+}
+
+func encryptedSignData(t *testing.T, password string) SignData {
+	cert, pkey := loadCertificateAndKey(t)
+
+	return SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name:   "John Doe",
+				Reason: "Approved (encrypted)",
+				Date:   time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Password:        password,
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	}
+}
+
+func TestSignEncryptedPDF(t *testing.T) {
+	for _, fixture := range encryptedFixtures {
+		passwords := []string{"user", "owner"}
+		if fixture == "aes-256-owner" {
+			passwords = []string{"", "owner"}
+		}
+
+		for _, password := range passwords {
+			t.Run(fixture+"/"+password, func(t *testing.T) {
+				testSignEncryptedPDF(t, "../testfiles/encrypted/"+fixture+".pdf", password)
+			})
+		}
+	}
+}
+
+func testSignEncryptedPDF(t *testing.T, input string, password string) {
+	output := t.TempDir() + "/signed.pdf"
+
+	sign_data := encryptedSignData(t, password)
+	sign_data.Appearance = Appearance{
+		Visible:     true,
+		LowerLeftX:  100,
+		LowerLeftY:  100,
+		UpperRightX: 300,
+		UpperRightY: 150,
+	}
+
+	if err := SignFile(input, output, sign_data); err != nil {
+		t.Fatalf("failed to sign encrypted document: %s", err)
+	}
+
+	// A second signature reads the encrypted strings of the first.
+	twice := t.TempDir() + "/twice.pdf"
+	if err := SignFile(output, twice, encryptedSignData(t, password)); err != nil {
+		t.Fatalf("failed to sign signed encrypted document: %s", err)
+	}
+
+	signed := mustReadFile(t, twice)
+	verifySignatureBytes(t, signed)
+
+	// The update is read with the encryption of the original document.
+	rdr, err := NewReader(bytes.NewReader(signed), int64(len(signed)), password)
+	if err != nil {
+		t.Fatalf("failed to open signed document: %s", err)
+	}
+
+	root := rdr.Trailer().Key("Root")
+	if lang := root.Key("Lang").Text(); lang != "en-US" {
+		t.Errorf("expected catalog language en-US, got %q", lang)
+	}
+
+	fields := root.Key("AcroForm").Key("Fields")
+	if fields.Len() != 2 {
+		t.Fatalf("expected 2 signature fields, got %d", fields.Len())
+	}
+	field := fields.Index(0)
+	if name := field.Key("T").Text(); name != "Signature 1" {
+		t.Errorf("expected field name Signature 1, got %q", name)
+	}
+	if name := fields.Index(1).Key("T").Text(); name != "Signature 2" {
+		t.Errorf("expected field name Signature 2, got %q", name)
+	}
+
+	signature := field.Key("V")
+	if name := signature.Key("Name").Text(); name != "John Doe" {
+		t.Errorf("expected signer name John Doe, got %q", name)
+	}
+	if reason := signature.Key("Reason").Text(); reason != "Approved (encrypted)" {
+		t.Errorf("expected reason, got %q", reason)
+	}
+
+	// The strings of the updated page are encrypted.
+	page := root.Key("Pages").Key("Kids").Index(0)
+	if page.Key("Annots").Len() != 1 {
+		t.Fatal("expected the widget in the annotations of the page")
+	}
+	if modified := page.Key("PieceInfo").Key("pdfsign").Key("LastModified").RawString(); modified != fixtureLastModified {
+		t.Errorf("expected page string %q, got %q", fixtureLastModified, modified)
+	}
+
+	appearance, err := readStream(field.Key("AP").Key("N"))
+	if err != nil {
+		t.Fatalf("failed to read appearance: %s", err)
+	}
+	if !bytes.Contains(appearance, []byte("(John Doe) Tj")) {
+		t.Errorf("expected decrypted appearance stream, got %q", appearance)
+	}
+}
+
+func readStream(v pdf.Value) ([]byte, error) {
+	var buffer bytes.Buffer
+	if _, err := buffer.ReadFrom(v.Reader()); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func TestSignEncryptedPDFInvalidPassword(t *testing.T) {
+	err := SignFile("../testfiles/encrypted/rc4-128.pdf", t.TempDir()+"/signed.pdf", encryptedSignData(t, "wrong"))
+	if !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+}
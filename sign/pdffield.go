@@ -0,0 +1,402 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/digitorus/pdf"
+	"github.com/mattetti/filebuffer"
+)
+
+// SignatureField describes an empty signature field that is added to a
+// document to be signed later. A field with an empty rectangle is invisible.
+type SignatureField struct {
+	Name string
+
+	Page        uint32
+	LowerLeftX  float64
+	LowerLeftY  float64
+	UpperRightX float64
+	UpperRightY float64
+}
+
+// signatureField is an existing signature field in the document.
+type signatureField struct {
+	field  pdf.Value // terminal field, receives the /V entry
+	widget pdf.Value // widget annotation of the field, may be the field itself
+}
+
+// findSignatureField searches the AcroForm, including nested /Kids, for the
+// signature field with the given fully qualified name.
+func (context *SignContext) findSignatureField(name string) (*signatureField, error) {
+	fields := context.PDFReader.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	if fields.IsNull() {
+		return nil, fmt.Errorf("signature field %q not found: document has no form fields", name)
+	}
+
+	field, ok := findFieldRec(fields, "", "", name)
+	if !ok {
+		return nil, fmt.Errorf("signature field %q not found", name)
+	}
+
+	if field.field_type != "Sig" {
+		return nil, fmt.Errorf("field %q is not a signature field", name)
+	}
+	if !field.value.Key("V").IsNull() {
+		return nil, fmt.Errorf("signature field %q is already signed", name)
+	}
+
+	// Only terminal fields have a value, the kids of a terminal field are
+	// widget annotations without a name.
+	kids := field.value.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		if !kids.Index(i).Key("T").IsNull() {
+			return nil, fmt.Errorf("field %q is not a terminal field", name)
+		}
+	}
+
+	signature_field := &signatureField{
+		field:  field.value,
+		widget: field.value,
+	}
+
+	// A field with a single widget may be merged with its widget annotation,
+	// otherwise the widgets are the kids of the field.
+	if field.value.Key("Subtype").Name() != "Widget" && kids.Len() > 0 {
+		signature_field.widget = kids.Index(0)
+	}
+
+	return signature_field, nil
+}
+
+type foundField struct {
+	value      pdf.Value
+	field_type string
+}
+
+// findFieldRec walks the field hierarchy, partial names are joined with a
+// period and the field type is inheritable.
+func findFieldRec(fields pdf.Value, parent_name string, parent_type string, name string) (foundField, bool) {
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Index(i)
+
+		partial_name := field.Key("T")
+		if partial_name.IsNull() {
+			// Widget annotations without a name are not fields.
+			continue
+		}
+
+		full_name := partial_name.Text()
+		if parent_name != "" {
+			full_name = parent_name + "." + full_name
+		}
+
+		field_type := parent_type
+		if ft := field.Key("FT"); !ft.IsNull() {
+			field_type = ft.Name()
+		}
+
+		if full_name == name {
+			return foundField{value: field, field_type: field_type}, true
+		}
+
+		if kids := field.Key("Kids"); kids.Len() > 0 {
+			if found, ok := findFieldRec(kids, full_name, field_type, name); ok {
+				return found, true
+			}
+		}
+	}
+
+	return foundField{}, false
+}
+
+// signExistingField points the existing signature field to the signature
+// object. The field keeps its rectangle, page and widget, an appearance is
+// created when the widget has a rectangle.
+func (context *SignContext) signExistingField() error {
+	signature_field, err := context.findSignatureField(context.SignData.FieldName)
+	if err != nil {
+		return err
+	}
+
+	if context.SignData.Signature.CertType != ApprovalSignature && context.SignData.Appearance.Visible {
+		return fmt.Errorf("visible signatures are only allowed for approval signatures")
+	}
+
+	field_ptr := signature_field.field.GetPtr()
+	widget_ptr := signature_field.widget.GetPtr()
+
+	// The field is visible when its widget has a rectangle, an appearance is
+	// created for it so that the signed widget isn't left without one.
+	rectangle, visible := fieldRectangle(signature_field.widget)
+	if context.SignData.Appearance.Visible && !visible {
+		return fmt.Errorf("signature field %q has no rectangle", context.SignData.FieldName)
+	}
+
+	var appearance_id uint32
+	if visible {
+		appearance, err := context.createAppearance(rectangle)
+		if err != nil {
+			return fmt.Errorf("failed to create appearance: %w", err)
+		}
+
+		appearance_id, err = context.addObject(appearance)
+		if err != nil {
+			return fmt.Errorf("failed to add appearance object: %w", err)
+		}
+	}
+
+	merged := field_ptr.GetID() == widget_ptr.GetID()
+
+	var field_buffer bytes.Buffer
+	field_buffer.WriteString("<<\n")
+	if appearance_id != 0 && merged {
+		context.copyDictEntries(&field_buffer, signature_field.field, "V", "AP")
+		field_buffer.WriteString(fmt.Sprintf("  /AP << /N %d 0 R >>\n", appearance_id))
+	} else {
+		context.copyDictEntries(&field_buffer, signature_field.field, "V")
+	}
+	if signature_field.field.Key("Lock").IsNull() {
+		field_buffer.WriteString(context.createLock(field_ptr.GetID()))
+	}
+	field_buffer.WriteString(fmt.Sprintf("  /V %d 0 R\n", context.SignData.objectId))
+	field_buffer.WriteString(">>\n")
+
+	if err := context.updateObject(field_ptr.GetID(), field_buffer.Bytes()); err != nil {
+		return fmt.Errorf("failed to update signature field: %w", err)
+	}
+	context.VisualSignData.objectId = field_ptr.GetID()
+
+	if appearance_id != 0 && !merged {
+		var widget_buffer bytes.Buffer
+		widget_buffer.WriteString("<<\n")
+		context.copyDictEntries(&widget_buffer, signature_field.widget, "AP")
+		widget_buffer.WriteString(fmt.Sprintf("  /AP << /N %d 0 R >>\n", appearance_id))
+		widget_buffer.WriteString(">>\n")
+
+		if err := context.updateObject(widget_ptr.GetID(), widget_buffer.Bytes()); err != nil {
+			return fmt.Errorf("failed to update signature widget: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// fieldRectangle returns the normalized rectangle of a widget annotation,
+// visible is false when the widget has no rectangle or it is too small for an
+// appearance.
+func fieldRectangle(widget pdf.Value) (rectangle [4]float64, visible bool) {
+	rect := widget.Key("Rect")
+	if rect.Len() != 4 {
+		return rectangle, false
+	}
+
+	rectangle = [4]float64{
+		math.Min(rect.Index(0).Float64(), rect.Index(2).Float64()),
+		math.Min(rect.Index(1).Float64(), rect.Index(3).Float64()),
+		math.Max(rect.Index(0).Float64(), rect.Index(2).Float64()),
+		math.Max(rect.Index(1).Float64(), rect.Index(3).Float64()),
+	}
+
+	return rectangle, rectangle[2]-rectangle[0] >= 1 && rectangle[3]-rectangle[1] >= 1
+}
+
+// copyDictEntries writes the entries of an existing dictionary except for
+// the skipped keys.
+func (context *SignContext) copyDictEntries(w *bytes.Buffer, dict pdf.Value, skip ...string) {
+	ptr := dict.GetPtr()
+
+	for _, key := range dict.Keys() {
+		if slices.Contains(skip, key) {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(w, "  /%s ", key)
+		context.serializeCatalogEntry(w, ptr.GetID(), ptr.GetID(), dict.Key(key))
+		w.WriteString("\n")
+	}
+}
+
+// SignatureFieldsOptions configures AddSignatureFields.
+type SignatureFieldsOptions struct {
+	// IgnoreDocMDP adds the fields to a certified document even when the
+	// certification doesn't allow it, which invalidates the certification.
+	IgnoreDocMDP bool
+}
+
+// AddSignatureFieldsFile adds empty signature fields to the input file, see
+// AddSignatureFields.
+func AddSignatureFieldsFile(input string, output string, fields []SignatureField, options SignatureFieldsOptions) error {
+	input_file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	output_file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output_file.Close()
+	}()
+
+	finfo, err := input_file.Stat()
+	if err != nil {
+		return err
+	}
+	size := finfo.Size()
+
+	rdr, err := pdf.NewReader(input_file, size)
+	if err != nil {
+		return err
+	}
+
+	return AddSignatureFields(input_file, output_file, rdr, size, fields, options)
+}
+
+// AddSignatureFields adds empty signature fields to the document as an
+// incremental update, the fields can be signed later by name using
+// SignData.FieldName or by other applications. A certified document only
+// accepts new fields when its DocMDP permission is 3, otherwise a
+// *DocMDPError is returned.
+func AddSignatureFields(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, fields []SignatureField, options SignatureFieldsOptions) error {
+	context := SignContext{
+		PDFReader:  rdr,
+		InputFile:  input,
+		OutputFile: output,
+		SignData:   SignData{IgnoreDocMDP: options.IgnoreDocMDP},
+		inputSize:  size,
+	}
+
+	existingSignatures, err := context.fetchExistingSignatures()
+	if err != nil {
+		return err
+	}
+	context.existingSignatures = existingSignatures
+
+	return context.AddSignatureFields(fields)
+}
+
+func (context *SignContext) AddSignatureFields(fields []SignatureField) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("no signature fields to add")
+	}
+	if isEncrypted(context.PDFReader) {
+		return &UnsupportedEncryptionError{Reason: "adding signature fields to an encrypted document"}
+	}
+	if err := context.checkFieldsDocMDP(); err != nil {
+		return err
+	}
+	fields = slices.Clone(fields)
+
+	root := context.PDFReader.Trailer().Key("Root")
+	existing_fields := root.Key("AcroForm").Key("Fields")
+
+	for i, field := range fields {
+		if field.Name == "" {
+			return fmt.Errorf("signature field name is required")
+		}
+		if strings.Contains(field.Name, ".") {
+			return fmt.Errorf("signature field name %q must not contain a period", field.Name)
+		}
+		if _, ok := findFieldRec(existing_fields, "", "", field.Name); ok {
+			return fmt.Errorf("field %q already exists", field.Name)
+		}
+		for _, other := range fields[:i] {
+			if other.Name == field.Name {
+				return fmt.Errorf("field %q is added twice", field.Name)
+			}
+		}
+		if field.Page == 0 {
+			fields[i].Page = 1
+		}
+	}
+
+	// The buffer only holds the incremental update.
+	context.OutputBuffer = filebuffer.New([]byte{})
+
+	// File always needs an empty line after %%EOF.
+	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
+		return err
+	}
+
+	var field_ids []uint32
+	var pages []uint32
+	page_annots := map[uint32][]uint32{}
+
+	for _, field := range fields {
+		page, err := findPageByNumber(root.Key("Pages"), field.Page)
+		if err != nil {
+			return err
+		}
+		page_ptr := page.GetPtr()
+
+		var widget bytes.Buffer
+		widget.WriteString("<<\n")
+		widget.WriteString("  /Type /Annot\n")
+		widget.WriteString("  /Subtype /Widget\n")
+		widget.WriteString(fmt.Sprintf("  /Rect [%f %f %f %f]\n", field.LowerLeftX, field.LowerLeftY, field.UpperRightX, field.UpperRightY))
+		widget.WriteString(fmt.Sprintf("  /P %d %d R\n", page_ptr.GetID(), page_ptr.GetGen()))
+		widget.WriteString(fmt.Sprintf("  /F %d\n", AnnotationFlagPrint))
+		widget.WriteString("  /FT /Sig\n")
+		widget.WriteString(fmt.Sprintf("  /T %s\n", pdfString(field.Name)))
+		widget.WriteString(">>\n")
+
+		field_id, err := context.addObject(widget.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to add signature field object: %w", err)
+		}
+		field_ids = append(field_ids, field_id)
+
+		if _, ok := page_annots[field.Page]; !ok {
+			pages = append(pages, field.Page)
+		}
+		page_annots[field.Page] = append(page_annots[field.Page], field_id)
+	}
+
+	// Add the widgets to the /Annots of their pages.
+	for _, page_number := range pages {
+		page, err := findPageByNumber(root.Key("Pages"), page_number)
+		if err != nil {
+			return err
+		}
+		page_ptr := page.GetPtr()
+
+		inc_page_update, err := context.createIncPageUpdate(page_number, page_annots[page_number]...)
+		if err != nil {
+			return fmt.Errorf("failed to create incremental page update: %w", err)
+		}
+		if err := context.updateObject(page_ptr.GetID(), inc_page_update); err != nil {
+			return fmt.Errorf("failed to add incremental page update object: %w", err)
+		}
+	}
+
+	// SignaturesExist
+	catalog, err := context.createFormCatalog(field_ids, 1)
+	if err != nil {
+		return fmt.Errorf("failed to create catalog: %w", err)
+	}
+
+	context.CatalogData.ObjectId, err = context.addObject(catalog)
+	if err != nil {
+		return fmt.Errorf("failed to add catalog object: %w", err)
+	}
+
+	if err := context.writeXref(); err != nil {
+		return fmt.Errorf("failed to write xref: %w", err)
+	}
+
+	if err := context.writeTrailer(); err != nil {
+		return fmt.Errorf("failed to write trailer: %w", err)
+	}
+
+	return context.writeOutput()
+}
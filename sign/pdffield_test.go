@@ -0,0 +1,409 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+// createFormPDF writes a document with a nested signature field
+// (form.approver), a signature field with a separate widget (reviewer), a
+// text field (name) and the common AcroForm entries.
+func createFormPDF(t *testing.T) string {
+	t.Helper()
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [4 0 R 6 0 R 9 0 R] /DA (/Helv 0 Tf 0 g) /DR << /Font << /Helv 10 0 R >> >> /NeedAppearances true /CO [9 0 R] /XFA 7 0 R >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 7 0 R /Annots [5 0 R 8 0 R 9 0 R] >>",
+		"<< /T (form) /FT /Sig /Kids [5 0 R] >>",
+		"<< /Type /Annot /Subtype /Widget /Parent 4 0 R /T (approver) /Rect [100 100 300 150] /P 3 0 R /F 4 >>",
+		"<< /T (reviewer) /FT /Sig /Kids [8 0 R] >>",
+		"<< /Length 0 >>\nstream\n\nendstream",
+		"<< /Type /Annot /Subtype /Widget /Parent 6 0 R /Rect [100 200 300 250] /P 3 0 R /F 4 >>",
+		"<< /Type /Annot /Subtype /Widget /FT /Tx /T (name) /Rect [100 300 300 320] /P 3 0 R /F 4 >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.7\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		_, _ = fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buffer.Len()
+	_, _ = fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		_, _ = fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	_, _ = fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	path := t.TempDir() + "/form.pdf"
+	if err := os.WriteFile(path, buffer.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func openPDF(t *testing.T, path string) *pdf.Reader {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+
+	finfo, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := pdf.NewReader(file, finfo.Size())
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err.Error())
+	}
+
+	return rdr
+}
+
+func TestSignExistingField(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input := createFormPDF(t)
+	tmpdir := t.TempDir()
+
+	signData := func(field string, visible bool) SignData {
+		return SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			Appearance: Appearance{
+				Visible: visible,
+			},
+			FieldName:       field,
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+		}
+	}
+
+	approved := tmpdir + "/approved.pdf"
+	if err := SignFile(input, approved, signData("form.approver", true)); err != nil {
+		t.Fatalf("failed to sign nested field: %s", err.Error())
+	}
+
+	reviewed := tmpdir + "/reviewed.pdf"
+	if err := SignFile(approved, reviewed, signData("reviewer", false)); err != nil {
+		t.Fatalf("failed to sign field with separate widget: %s", err.Error())
+	}
+
+	verifySignedBytes(t, mustReadFile(t, reviewed))
+
+	rdr := openPDF(t, reviewed)
+	acroForm := rdr.Trailer().Key("Root").Key("AcroForm")
+	if acroForm.Key("SigFlags").Int64() != 3 {
+		t.Errorf("expected SigFlags 3, got %d", acroForm.Key("SigFlags").Int64())
+	}
+	if acroForm.Key("DA").Text() != "/Helv 0 Tf 0 g" {
+		t.Errorf("expected /DA to be preserved, got %q", acroForm.Key("DA").Text())
+	}
+
+	fields := acroForm.Key("Fields")
+	if fields.Len() != 3 {
+		t.Fatalf("expected 3 fields, got %d", fields.Len())
+	}
+
+	approver := fields.Index(0).Key("Kids").Index(0)
+	if approver.Key("V").Key("Type").Name() != "Sig" {
+		t.Error("expected form.approver to be signed")
+	}
+	if approver.Key("AP").Key("N").IsNull() {
+		t.Error("expected an appearance for the visible signature")
+	}
+	if approver.Key("Rect").Index(2).Float64() != 300 {
+		t.Error("expected the rectangle of form.approver to be kept")
+	}
+
+	reviewer := fields.Index(1)
+	if reviewer.Key("V").Key("Type").Name() != "Sig" {
+		t.Error("expected reviewer to be signed")
+	}
+	if reviewer.Key("Kids").Len() != 1 {
+		t.Error("expected the widget of reviewer to be kept")
+	}
+
+	if !fields.Index(2).Key("V").IsNull() {
+		t.Error("expected the text field to be untouched")
+	}
+
+	// The page already references the widgets, no annotations are added.
+	if annots := rdr.Trailer().Key("Root").Key("Pages").Key("Kids").Index(0).Key("Annots"); annots.Len() != 3 {
+		t.Errorf("expected 3 annotations, got %d", annots.Len())
+	}
+}
+
+func TestSignExistingFieldErrors(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input := createFormPDF(t)
+	tmpdir := t.TempDir()
+
+	sign := func(input, field string) error {
+		return SignFile(input, tmpdir+"/output.pdf", SignData{
+			Signature: SignDataSignature{
+				CertType: ApprovalSignature,
+			},
+			FieldName:       field,
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+		})
+	}
+
+	tests := []struct {
+		field string
+		error string
+	}{
+		{"missing", "not found"},
+		{"form", "not a terminal field"},
+		{"name", "not a signature field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			err := sign(input, tt.field)
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("expected error containing %q, got %v", tt.error, err)
+			}
+		})
+	}
+
+	signed := tmpdir + "/signed.pdf"
+	if err := SignFile(input, signed, SignData{
+		Signature:       SignDataSignature{CertType: ApprovalSignature},
+		FieldName:       "reviewer",
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sign(signed, "reviewer"); err == nil || !strings.Contains(err.Error(), "already signed") {
+		t.Errorf("expected an error for a signed field, got %v", err)
+	}
+}
+
+func TestSignExistingFieldAppearance(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tmpdir := t.TempDir()
+	prepared := tmpdir + "/prepared.pdf"
+
+	err := AddSignatureFieldsFile("../testfiles/testfile20.pdf", prepared, []SignatureField{
+		{Name: "approver", Page: 1, LowerLeftX: 300, LowerLeftY: 150, UpperRightX: 100, UpperRightY: 100},
+		{Name: "witness"},
+	}, SignatureFieldsOptions{})
+	if err != nil {
+		t.Fatalf("failed to add signature fields: %s", err)
+	}
+
+	// The appearance follows from the rectangle of the field, without
+	// Appearance.Visible.
+	sign := func(input, output, field string) {
+		t.Helper()
+
+		err := SignFile(input, output, SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			FieldName:       field,
+			DigestAlgorithm: crypto.SHA256,
+			Signer:          pkey,
+			Certificate:     cert,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign %s: %s", field, err)
+		}
+	}
+
+	approved := tmpdir + "/approved.pdf"
+	sign(prepared, approved, "approver")
+	witnessed := tmpdir + "/witnessed.pdf"
+	sign(approved, witnessed, "witness")
+
+	verifySignedBytes(t, mustReadFile(t, witnessed))
+
+	fields := openPDF(t, witnessed).Trailer().Key("Root").Key("AcroForm").Key("Fields")
+
+	approver := fields.Index(0)
+	if approver.Key("V").IsNull() {
+		t.Fatal("expected approver to be signed")
+	}
+	appearance := approver.Key("AP").Key("N")
+	if appearance.IsNull() {
+		t.Fatal("expected an appearance for the visible field")
+	}
+	if bbox := appearance.Key("BBox"); bbox.Index(2).Float64() != 200 || bbox.Index(3).Float64() != 50 {
+		t.Errorf("expected a 200x50 appearance, got %v", bbox)
+	}
+
+	witness := fields.Index(1)
+	if witness.Key("V").IsNull() {
+		t.Fatal("expected witness to be signed")
+	}
+	if !witness.Key("AP").Key("N").IsNull() {
+		t.Error("expected no appearance for the invisible field")
+	}
+}
+
+func TestSignPreservesAcroForm(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input := createFormPDF(t)
+	signed := t.TempDir() + "/signed.pdf"
+
+	err := SignFile(input, signed, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err.Error())
+	}
+
+	verifySignedBytes(t, mustReadFile(t, signed))
+
+	acroForm := openPDF(t, signed).Trailer().Key("Root").Key("AcroForm")
+
+	fields := acroForm.Key("Fields")
+	if fields.Len() != 4 {
+		t.Fatalf("expected 4 fields, got %d", fields.Len())
+	}
+	for i, name := range []string{"form", "reviewer", "name"} {
+		if fields.Index(i).Key("T").Text() != name {
+			t.Errorf("expected field %d to be %q, got %q", i, name, fields.Index(i).Key("T").Text())
+		}
+	}
+	if fields.Index(3).Key("V").Key("Type").Name() != "Sig" {
+		t.Error("expected the new signature field to be appended")
+	}
+
+	if acroForm.Key("DA").Text() != "/Helv 0 Tf 0 g" {
+		t.Errorf("expected /DA to be preserved, got %q", acroForm.Key("DA").Text())
+	}
+	if acroForm.Key("DR").Key("Font").Key("Helv").Key("BaseFont").Name() != "Helvetica" {
+		t.Error("expected /DR to be preserved")
+	}
+	if !acroForm.Key("NeedAppearances").Bool() {
+		t.Error("expected /NeedAppearances to be preserved")
+	}
+	if acroForm.Key("CO").Index(0).Key("T").Text() != "name" {
+		t.Error("expected /CO to be preserved")
+	}
+	if acroForm.Key("XFA").Kind() != pdf.Stream {
+		t.Error("expected /XFA to be preserved")
+	}
+	if acroForm.Key("SigFlags").Int64() != 3 {
+		t.Errorf("expected SigFlags 3, got %d", acroForm.Key("SigFlags").Int64())
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAddSignatureFields(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tmpdir := t.TempDir()
+	prepared := tmpdir + "/prepared.pdf"
+
+	err := AddSignatureFieldsFile("../testfiles/testfile20.pdf", prepared, []SignatureField{
+		{Name: "approver", Page: 1, LowerLeftX: 100, LowerLeftY: 100, UpperRightX: 300, UpperRightY: 150},
+		{Name: "reviewer", Page: 1, LowerLeftX: 100, LowerLeftY: 200, UpperRightX: 300, UpperRightY: 250},
+		{Name: "witness"},
+	}, SignatureFieldsOptions{})
+	if err != nil {
+		t.Fatalf("failed to add signature fields: %s", err.Error())
+	}
+
+	rdr := openPDF(t, prepared)
+	acroForm := rdr.Trailer().Key("Root").Key("AcroForm")
+	if acroForm.Key("Fields").Len() != 3 {
+		t.Fatalf("expected 3 fields, got %d", acroForm.Key("Fields").Len())
+	}
+	if acroForm.Key("SigFlags").Int64() != 1 {
+		t.Errorf("expected SigFlags 1, got %d", acroForm.Key("SigFlags").Int64())
+	}
+	for i := 0; i < 3; i++ {
+		field := acroForm.Key("Fields").Index(i)
+		if field.Key("FT").Name() != "Sig" || !field.Key("V").IsNull() {
+			t.Errorf("expected field %d to be an empty signature field", i)
+		}
+	}
+	if annots := rdr.Trailer().Key("Root").Key("Pages").Key("Kids").Index(0).Key("Annots"); annots.Len() != 3 {
+		t.Errorf("expected 3 annotations, got %d", annots.Len())
+	}
+
+	err = AddSignatureFieldsFile(prepared, tmpdir+"/duplicate.pdf", []SignatureField{{Name: "approver"}}, SignatureFieldsOptions{})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error for an existing field, got %v", err)
+	}
+
+	signed := tmpdir + "/signed.pdf"
+	err = SignFile(prepared, signed, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Appearance:      Appearance{Visible: true},
+		FieldName:       "reviewer",
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign added field: %s", err.Error())
+	}
+
+	verifySignedBytes(t, mustReadFile(t, signed))
+
+	rdr = openPDF(t, signed)
+	if rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(1).Key("V").IsNull() {
+		t.Error("expected reviewer to be signed")
+	}
+}
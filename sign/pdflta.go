@@ -0,0 +1,112 @@
+package sign
+
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/digitorus/pdf"
+)
+
+// LTAOptions configures the extension of a signed document to PAdES B-LTA.
+type LTAOptions struct {
+	// TSA is used for the archive document timestamp.
+	TSA TSA
+
+	// DigestAlgorithm used for the document timestamp, defaults to SHA-256.
+	DigestAlgorithm crypto.Hash
+
+	// DSS contains additional validation material and the function used to
+	// retrieve revocation data for the certificates of existing signatures,
+	// DefaultEmbedRevocationStatusFunction when none is set.
+	DSS DSSData
+}
+
+// ExtendLTAFile extends the signatures in the input file to PAdES B-LTA, see
+// ExtendLTA.
+func ExtendLTAFile(input string, output string, options LTAOptions) error {
+	input_file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	output_file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output_file.Close()
+	}()
+
+	return ExtendLTA(input_file, output_file, options)
+}
+
+// ExtendLTA extends the signatures of an already signed document to PAdES
+// B-LTA. The validation material of all signatures and document timestamps is
+// written to the Document Security Store in a first incremental update, a
+// second incremental update adds an archive document timestamp covering it.
+//
+// Extending a document again refreshes the validation material, including
+// that of the previous archive timestamp, and adds a new archive timestamp.
+func ExtendLTA(input io.ReadSeeker, output io.Writer, options LTAOptions) error {
+	if options.TSA.URL == "" {
+		return fmt.Errorf("TSA URL is required for an archive timestamp")
+	}
+
+	size, err := input.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	reader_at, ok := input.(io.ReaderAt)
+	if !ok {
+		reader_at = readerAt{input}
+	}
+
+	rdr, err := pdf.NewReader(reader_at, size)
+	if err != nil {
+		return err
+	}
+
+	// B-LTA requires the revocation data of all certificates.
+	dss := options.DSS
+	if dss.RevocationFunction == nil {
+		dss.RevocationFunction = DefaultEmbedRevocationStatusFunction
+	}
+
+	dss_context := SignContext{
+		PDFReader: rdr,
+		InputFile: input,
+		inputSize: size,
+	}
+	if err := dss_context.createDSSUpdate(dss); err != nil {
+		return fmt.Errorf("failed to add DSS: %w", err)
+	}
+
+	// The DSS revision is the input followed by the DSS update, only the
+	// update is kept in memory. The timestamp writes both to the output.
+	update := dss_context.OutputBuffer.Buff.Bytes()
+	dss_size := size + int64(len(update))
+	dss_reader := io.NewSectionReader(appendedReaderAt{reader_at, size, update}, 0, dss_size)
+	dss_rdr, err := pdf.NewReader(dss_reader, dss_size)
+	if err != nil {
+		return fmt.Errorf("failed to read DSS revision: %w", err)
+	}
+
+	err = Sign(dss_reader, output, dss_rdr, dss_size, SignData{
+		Signature: SignDataSignature{
+			CertType: TimeStampSignature,
+		},
+		DigestAlgorithm: options.DigestAlgorithm,
+		TSA:             options.TSA,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add archive timestamp: %w", err)
+	}
+
+	return nil
+}
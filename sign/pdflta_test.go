@@ -0,0 +1,219 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestExtendLTA(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	tmpdir := t.TempDir()
+	signedFile := tmpdir + "/signed.pdf"
+	ltaFile := tmpdir + "/lta.pdf"
+	ltaTwiceFile := tmpdir + "/lta_twice.pdf"
+
+	err := SignFile("../testfiles/testfile20.pdf", signedFile, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+			PAdES:    true,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+		TSA: TSA{
+			URL: tsa.URL,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err.Error())
+	}
+
+	options := LTAOptions{
+		TSA: TSA{
+			URL: tsa.URL,
+		},
+	}
+
+	if err := ExtendLTAFile(signedFile, ltaFile, options); err != nil {
+		t.Fatalf("failed to extend: %s", err.Error())
+	}
+
+	// The signature timestamp certificate is part of the DSS.
+	dss := readDSS(t, ltaFile)
+	if dss.Key("Certs").Len() != 2 {
+		t.Errorf("expected 2 certificates, got %d", dss.Key("Certs").Len())
+	}
+
+	// Extending again adds the validation material of the archive timestamp
+	// and a new archive timestamp.
+	if err := ExtendLTAFile(ltaFile, ltaTwiceFile, options); err != nil {
+		t.Fatalf("failed to extend twice: %s", err.Error())
+	}
+
+	dss = readDSS(t, ltaTwiceFile)
+	if len(dss.Key("VRI").Keys()) != 2 {
+		t.Errorf("expected 2 VRI entries, got %d", len(dss.Key("VRI").Keys()))
+	}
+
+	file, err := os.Open(ltaTwiceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	response, err := verify.VerifyFile(file)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err.Error())
+	}
+	if response.Error != "" {
+		t.Errorf("unexpected verification error: %s", response.Error)
+	}
+	if len(response.Signers) != 3 {
+		t.Errorf("expected 3 signatures, got %d", len(response.Signers))
+	}
+	for i, signer := range response.Signers {
+		if !signer.ValidSignature {
+			t.Errorf("signature %d is not valid", i)
+		}
+		if signer.TimeStamp == nil {
+			t.Errorf("signature %d has no timestamp", i)
+		}
+	}
+}
+
+func TestExtendLTADefaultRevocation(t *testing.T) {
+	tsa := newTestTSA(t)
+
+	ca_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca_template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca_der, err := x509.CreateCertificate(rand.Reader, ca_template, ca_template, ca_key.Public(), ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(ca_der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The responder is started first, its URLs are part of the certificate.
+	var ocsp_response, crl []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ocsp") {
+			_, _ = w.Write(ocsp_response)
+			return
+		}
+		_, _ = w.Write(crl)
+	}))
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "John Doe"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		OCSPServer:            []string{server.URL + "/ocsp"},
+		CRLDistributionPoints: []string{server.URL + "/ca.crl"},
+	}, ca, key.Public(), ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ocsp_response, err = ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpdir := t.TempDir()
+	signedFile := tmpdir + "/signed.pdf"
+	ltaFile := tmpdir + "/lta.pdf"
+
+	err = SignFile("../testfiles/testfile20.pdf", signedFile, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+			PAdES:    true,
+		},
+		DigestAlgorithm:   crypto.SHA256,
+		Signer:            key,
+		Certificate:       cert,
+		CertificateChains: [][]*x509.Certificate{{cert, ca}},
+		TSA:               TSA{URL: tsa.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+
+	// No RevocationFunction is set, the default fetches the OCSP response
+	// and the CRL of the signer certificate.
+	if err := ExtendLTAFile(signedFile, ltaFile, LTAOptions{TSA: TSA{URL: tsa.URL}}); err != nil {
+		t.Fatalf("failed to extend: %s", err)
+	}
+
+	dss := readDSS(t, ltaFile)
+	if dss.Key("OCSPs").Len() != 1 {
+		t.Errorf("expected 1 OCSP response, got %d", dss.Key("OCSPs").Len())
+	}
+	if dss.Key("CRLs").Len() != 1 {
+		t.Errorf("expected 1 CRL, got %d", dss.Key("CRLs").Len())
+	}
+}
+
+func TestExtendLTARequiresTSA(t *testing.T) {
+	if err := ExtendLTAFile("../testfiles/testfile20.pdf", t.TempDir()+"/lta.pdf", LTAOptions{}); err == nil {
+		t.Error("expected error without TSA")
+	}
+}
@@ -3,18 +3,17 @@ package sign
 import (
 	"bytes"
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
 	"strconv"
 
+	"github.com/digitorus/pdfsign/internal/algorithm"
 	"github.com/digitorus/pkcs7"
-	"github.com/digitorus/timestamp"
 	"golang.org/x/crypto/cryptobyte"
 	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
 )
@@ -25,10 +24,19 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 	// Using a buffer because it's way faster than concatenating.
 	var signature_buffer bytes.Buffer
 
+	// Strings of encrypted documents are encrypted for the signature object.
+	object_id := context.getNextObjectID()
+
 	signature_buffer.WriteString("<<\n")
 	signature_buffer.WriteString(" /Type /Sig\n")
 	signature_buffer.WriteString(" /Filter /Adobe.PPKLite\n")
-	signature_buffer.WriteString(" /SubFilter /adbe.pkcs7.detached\n")
+	if context.SignData.Signature.PAdES {
+		// ETSI EN 319 142-1, 5.3: PAdES baseline signatures shall use the
+		// ETSI.CAdES.detached SubFilter.
+		signature_buffer.WriteString(" /SubFilter /ETSI.CAdES.detached\n")
+	} else {
+		signature_buffer.WriteString(" /SubFilter /adbe.pkcs7.detached\n")
+	}
 
 	signature_buffer.WriteString(context.createPropBuild())
 
@@ -108,7 +116,10 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 		//     All - All form fields
 		//     Include - Only those form fields specified in Fields.
 		//     Exclude - Only those form fields not specified in Fields.
-		signature_buffer.WriteString("     /Action /All\n")
+		//
+		// Fields [array]: (Required if Action is Include or Exclude) An array of
+		//   text strings containing field names.
+		context.writeFieldMDPAction(&signature_buffer, object_id, "     ")
 
 		// V [name]: (Optional; required for PDF 1.5 and later) The transform parameters
 		//   dictionary version. The value for PDF 1.5 and later shall be 1.2.
@@ -147,22 +158,22 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 
 	if context.SignData.Signature.Info.Name != "" {
 		signature_buffer.WriteString(" /Name ")
-		signature_buffer.WriteString(pdfString(context.SignData.Signature.Info.Name))
+		signature_buffer.WriteString(context.encryptText(object_id, context.SignData.Signature.Info.Name))
 		signature_buffer.WriteString("\n")
 	}
 	if context.SignData.Signature.Info.Location != "" {
 		signature_buffer.WriteString(" /Location ")
-		signature_buffer.WriteString(pdfString(context.SignData.Signature.Info.Location))
+		signature_buffer.WriteString(context.encryptText(object_id, context.SignData.Signature.Info.Location))
 		signature_buffer.WriteString("\n")
 	}
 	if context.SignData.Signature.Info.Reason != "" {
 		signature_buffer.WriteString(" /Reason ")
-		signature_buffer.WriteString(pdfString(context.SignData.Signature.Info.Reason))
+		signature_buffer.WriteString(context.encryptText(object_id, context.SignData.Signature.Info.Reason))
 		signature_buffer.WriteString("\n")
 	}
 	if context.SignData.Signature.Info.ContactInfo != "" {
 		signature_buffer.WriteString(" /ContactInfo ")
-		signature_buffer.WriteString(pdfString(context.SignData.Signature.Info.ContactInfo))
+		signature_buffer.WriteString(context.encryptText(object_id, context.SignData.Signature.Info.ContactInfo))
 		signature_buffer.WriteString("\n")
 	}
 
@@ -176,9 +187,9 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 	//
 	// A timestamp can be embedded in a CMS binary data object (see 12.8.3.3, "CMS
 	// (PKCS #7) signatures").
-	if context.SignData.TSA.URL == "" && !context.SignData.Signature.Info.Date.IsZero() {
+	if context.SignData.TSA.URL == "" && !context.SignData.Signature.PAdES && !context.SignData.Signature.Info.Date.IsZero() {
 		signature_buffer.WriteString(" /M ")
-		signature_buffer.WriteString(pdfDateTime(context.SignData.Signature.Info.Date))
+		signature_buffer.WriteString(context.encryptString(object_id, pdfDate(context.SignData.Signature.Info.Date)))
 		signature_buffer.WriteString("\n")
 	}
 
@@ -245,14 +256,17 @@ func (context *SignContext) createSigningCertificateAttribute() (*pkcs7.Attribut
 	hash := context.SignData.DigestAlgorithm.New()
 	hash.Write(context.SignData.Certificate.Raw)
 
+	// The legacy signing-certificate attribute only supports SHA-1, PAdES
+	// always requires signing-certificate-v2.
+	v1 := context.SignData.DigestAlgorithm.HashFunc() == crypto.SHA1 && !context.SignData.Signature.PAdES
+
 	var b cryptobyte.Builder
 	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // SigningCertificate
 		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // []ESSCertID, []ESSCertIDv2
 			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // ESSCertID, ESSCertIDv2
-				if context.SignData.DigestAlgorithm.HashFunc() != crypto.SHA1 &&
-					context.SignData.DigestAlgorithm.HashFunc() != crypto.SHA256 { // default SHA-256
+				if !v1 && context.SignData.DigestAlgorithm.HashFunc() != crypto.SHA256 { // default SHA-256
 					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // AlgorithmIdentifier
-						b.AddASN1ObjectIdentifier(getOIDFromHashAlgorithm(context.SignData.DigestAlgorithm))
+						b.AddASN1ObjectIdentifier(algorithm.OIDFromHash(context.SignData.DigestAlgorithm))
 					})
 				}
 				b.AddASN1OctetString(hash.Sum(nil)) // certHash
@@ -265,27 +279,16 @@ func (context *SignContext) createSigningCertificateAttribute() (*pkcs7.Attribut
 		return nil, err
 	}
 	signingCertificate := pkcs7.Attribute{
-		Type:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}, // SigningCertificateV2
+		Type:  oidAttributeSigningCertificateV2,
 		Value: asn1.RawValue{FullBytes: sse},
 	}
-	if context.SignData.DigestAlgorithm.HashFunc() == crypto.SHA1 {
-		signingCertificate.Type = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12} // SigningCertificate
+	if v1 {
+		signingCertificate.Type = oidAttributeSigningCertificate
 	}
 	return &signingCertificate, nil
 }
 
 func (context *SignContext) createSignature() ([]byte, error) {
-	if _, err := context.OutputBuffer.Seek(0, 0); err != nil {
-		return nil, err
-	}
-
-	// Sadly we can't efficiently sign a file, we need to read all the bytes we want to sign.
-	file_content := context.OutputBuffer.Buff.Bytes()
-
-	// Collect the parts to sign.
-	sign_content := make([]byte, 0)
-	sign_content = append(sign_content, file_content[context.ByteRangeValues[0]:(context.ByteRangeValues[0]+context.ByteRangeValues[1])]...)
-	sign_content = append(sign_content, file_content[context.ByteRangeValues[2]:(context.ByteRangeValues[2]+context.ByteRangeValues[3])]...)
 
 	// Return the timestamp if we are signing a timestamp.
 	if context.SignData.Signature.CertType == TimeStampSignature {
@@ -300,137 +303,228 @@ func (context *SignContext) createSignature() ([]byte, error) {
 		// entire document, including the Document Time-stamp dictionary but excluding
 		// the TimeStampToken itself (the entry with key Contents).
 
-		timestamp_response, err := context.GetTSA(sign_content)
+		sign_content, err := context.signContentReader()
 		if err != nil {
-			return nil, fmt.Errorf("get timestamp: %w", err)
+			return nil, err
 		}
 
-		ts, err := timestamp.ParseResponse(timestamp_response)
+		ts, err := context.getTSA(sign_content)
 		if err != nil {
-			return nil, fmt.Errorf("parse timestamp: %w", err)
+			return nil, fmt.Errorf("get timestamp: %w", err)
 		}
 
 		return ts.RawToken, nil
 	}
 
-	// Initialize pkcs7 signer.
-	signed_data, err := pkcs7.NewSignedData(sign_content)
+	content_digest, err := context.hashSignContent()
+	if err != nil {
+		return nil, err
+	}
+
+	signed_data, err := context.createSignedData(content_digest)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is calculated over the DER encoded SET OF signed attributes.
+	signer_info := &signed_data.GetSignedData().SignerInfos[0]
+	signed_attributes, err := asn1.MarshalWithParams(signer_info.AuthenticatedAttributes, "set")
+	if err != nil {
+		return nil, fmt.Errorf("marshal signed attributes: %w", err)
+	}
+
+	signer_info.EncryptedDigest, err = context.signAttributes(signed_attributes)
+	if err != nil {
+		return nil, fmt.Errorf("sign attributes: %w", err)
+	}
+
+	return context.finishSignedData(signed_data)
+}
+
+// createSignedData creates the CMS signed data and its signed attributes for
+// the digest of the ByteRange, the signature value itself is left empty.
+func (context *SignContext) createSignedData(content_digest []byte) (*pkcs7.SignedData, error) {
+	// Initialize pkcs7 signer, the content is hashed by the caller so the
+	// document doesn't have to be kept in memory.
+	signed_data, err := pkcs7.NewSignedData(nil)
 	if err != nil {
 		return nil, fmt.Errorf("new signed data: %w", err)
 	}
 
-	signed_data.SetDigestAlgorithm(getOIDFromHashAlgorithm(context.SignData.DigestAlgorithm))
+	signed_data.SetDigestAlgorithm(algorithm.OIDFromHash(context.SignData.DigestAlgorithm))
+
+	// RFC 8419, 3.2: the signature algorithm of EdDSA is the algorithm of
+	// the public key, without parameters.
+	if isPureEdDSA(context.SignData.Certificate) {
+		signed_data.SetEncryptionAlgorithm(publicKeyAlgorithm(context.SignData.Certificate))
+	}
 	signingCertificate, err := context.createSigningCertificateAttribute()
 	if err != nil {
 		return nil, fmt.Errorf("new signed data: %w", err)
 	}
 
-	signer_config := pkcs7.SignerInfoConfig{
-		ExtraSignedAttributes: []pkcs7.Attribute{
-			{
-				Type:  asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8},
-				Value: context.SignData.RevocationData,
-			},
-			*signingCertificate,
-		},
+	extra_attributes, err := context.extraSignedAttributes()
+	if err != nil {
+		return nil, err
+	}
+	if context.SignData.ContentTimestamp {
+		content_timestamp, err := context.contentTimestampAttribute(content_digest)
+		if err != nil {
+			return nil, err
+		}
+		extra_attributes = append(extra_attributes, content_timestamp)
+	}
+
+	// Custom attributes replace the attributes of the same type added here.
+	signer_config := pkcs7.SignerInfoConfig{}
+	if findAttribute(extra_attributes, oidAttributeSigningCertificate) == nil && findAttribute(extra_attributes, oidAttributeSigningCertificateV2) == nil {
+		signer_config.ExtraSignedAttributes = append(signer_config.ExtraSignedAttributes, *signingCertificate)
 	}
 
+	// PAdES signatures shall not contain the Adobe revocation attribute,
+	// revocation data is stored in the Document Security Store instead.
+	if !context.SignData.Signature.PAdES && findAttribute(extra_attributes, oidAttributeAdobeRevocation) == nil {
+		signer_config.ExtraSignedAttributes = append(signer_config.ExtraSignedAttributes, pkcs7.Attribute{
+			Type:  oidAttributeAdobeRevocation,
+			Value: context.SignData.RevocationData,
+		})
+	}
+
+	signer_config.ExtraSignedAttributes = append(signer_config.ExtraSignedAttributes, extra_attributes...)
+
 	// Add the first certificate chain without our own certificate.
 	var certificate_chain []*x509.Certificate
 	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 1 {
 		certificate_chain = context.SignData.CertificateChains[0][1:]
 	}
 
-	// Add the signer and sign the data.
-	if err := signed_data.AddSignerChain(context.SignData.Certificate, context.SignData.Signer, certificate_chain, signer_config); err != nil {
+	// Add the signer, the signature itself is created below once the signed
+	// attributes are final.
+	if err := signed_data.AddSignerChain(context.SignData.Certificate, placeholderSigner{context.SignData.Certificate.PublicKey}, certificate_chain, signer_config); err != nil {
 		return nil, fmt.Errorf("add signer chain: %w", err)
 	}
 
-	// PDF needs a detached signature, meaning the content isn't included.
-	signed_data.Detach()
-
-	if context.SignData.TSA.URL != "" {
-		signature_data := signed_data.GetSignedData()
+	signer_info := &signed_data.GetSignedData().SignerInfos[0]
 
-		timestamp_response, err := context.GetTSA(signature_data.SignerInfos[0].EncryptedDigest)
-		if err != nil {
-			return nil, fmt.Errorf("get timestamp: %w", err)
+	if context.SignData.RSAPSS {
+		if _, ok := context.SignData.Certificate.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("RSASSA-PSS requires an RSA certificate")
 		}
 
-		ts, err := timestamp.ParseResponse(timestamp_response)
+		signer_info.DigestEncryptionAlgorithm, err = algorithm.PSSAlgorithmIdentifier(context.SignData.DigestAlgorithm, context.SignData.DigestAlgorithm.Size())
 		if err != nil {
-			return nil, fmt.Errorf("parse timestamp: %w", err)
+			return nil, err
 		}
+	}
 
-		_, err = pkcs7.Parse(ts.RawToken)
-		if err != nil {
-			return nil, fmt.Errorf("parse timestamp token: %w", err)
+	// Replace the message digest of the empty content by the digest of the
+	// ByteRange, it has the same length so the attribute order is unchanged.
+	message_digest, err := asn1.Marshal(content_digest)
+	if err != nil {
+		return nil, fmt.Errorf("marshal message digest: %w", err)
+	}
+	for i, attribute := range signer_info.AuthenticatedAttributes {
+		if attribute.Type.Equal(pkcs7.OIDAttributeMessageDigest) {
+			signer_info.AuthenticatedAttributes[i].Value.Bytes = message_digest
 		}
+	}
 
-		timestamp_attribute := pkcs7.Attribute{
-			Type:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14},
-			Value: asn1.RawValue{FullBytes: ts.RawToken},
+	// ETSI EN 319 142-1, 5.3: the signing-time attribute shall not be present
+	// in PAdES signatures, pkcs7 always adds it. A custom signing-time
+	// attribute is kept instead of the one added by pkcs7.
+	signing_time := findAttribute(extra_attributes, pkcs7.OIDAttributeSigningTime)
+	if context.SignData.Signature.PAdES || signing_time != nil {
+		var signing_time_value []byte
+		if signing_time != nil {
+			signing_time_value, err = asn1.Marshal(signing_time.Value)
+			if err != nil {
+				return nil, fmt.Errorf("marshal signing time: %w", err)
+			}
 		}
-		if err := signature_data.SignerInfos[0].SetUnauthenticatedAttributes([]pkcs7.Attribute{timestamp_attribute}); err != nil {
-			return nil, err
+
+		attributes := signer_info.AuthenticatedAttributes[:0]
+		for _, attribute := range signer_info.AuthenticatedAttributes {
+			if attribute.Type.Equal(pkcs7.OIDAttributeSigningTime) {
+				if signing_time_value == nil || !bytes.Equal(attribute.Value.Bytes, signing_time_value) {
+					continue
+				}
+				signing_time_value = nil
+			}
+			attributes = append(attributes, attribute)
 		}
+		signer_info.AuthenticatedAttributes = attributes
 	}
 
-	return signed_data.Finish()
+	return signed_data, nil
 }
 
-func (context *SignContext) GetTSA(sign_content []byte) (timestamp_response []byte, err error) {
-	sign_reader := bytes.NewReader(sign_content)
-	ts_request, err := timestamp.CreateRequest(sign_reader, &timestamp.RequestOptions{
-		Hash:         context.SignData.DigestAlgorithm,
-		Certificates: true,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// finishSignedData adds the signature timestamp and returns the DER encoded
+// detached CMS signature.
+func (context *SignContext) finishSignedData(signed_data *pkcs7.SignedData) ([]byte, error) {
+	// PDF needs a detached signature, meaning the content isn't included.
+	signed_data.Detach()
+
+	signature_data := signed_data.GetSignedData()
+	unsigned_attributes := append([]pkcs7.Attribute{}, context.SignData.UnsignedAttributes...)
+
+	if context.SignData.TSA.URL != "" {
+		ts, err := context.getTSA(bytes.NewReader(signature_data.SignerInfos[0].EncryptedDigest))
+		if err != nil {
+			return nil, fmt.Errorf("get timestamp: %w", err)
+		}
+
+		unsigned_attributes = append(unsigned_attributes, pkcs7.Attribute{
+			Type:  oidAttributeTimestampToken,
+			Value: asn1.RawValue{FullBytes: ts.RawToken},
+		})
 	}
 
-	ts_request_reader := bytes.NewReader(ts_request)
-	req, err := http.NewRequest("POST", context.SignData.TSA.URL, ts_request_reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to prepare request (%s): %w", context.SignData.TSA.URL, err)
+	if len(unsigned_attributes) > 0 {
+		if err := signature_data.SignerInfos[0].SetUnauthenticatedAttributes(unsigned_attributes); err != nil {
+			return nil, fmt.Errorf("set unsigned attributes: %w", err)
+		}
 	}
 
-	req.Header.Add("Content-Type", "application/timestamp-query")
-	req.Header.Add("Content-Transfer-Encoding", "binary")
+	return signed_data.Finish()
+}
 
-	if context.SignData.TSA.Username != "" && context.SignData.TSA.Password != "" {
-		req.SetBasicAuth(context.SignData.TSA.Username, context.SignData.TSA.Password)
-	}
+// placeholderSigner is passed to pkcs7 when adding the signer so that the signed
+// attributes can still be altered, the actual signature is created by
+// signAttributes.
+type placeholderSigner struct {
+	public crypto.PublicKey
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	code := 0
+func (s placeholderSigner) Public() crypto.PublicKey {
+	return s.public
+}
 
-	if resp != nil {
-		code = resp.StatusCode
-	}
+func (s placeholderSigner) Sign(_ io.Reader, _ []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return nil, nil
+}
 
-	if err != nil || (code < 200 || code > 299) {
-		if err == nil {
-			defer func() {
-				_ = resp.Body.Close()
-			}()
-			body, _ := io.ReadAll(resp.Body)
-			return nil, errors.New("non success response (" + strconv.Itoa(code) + "): " + string(body))
-		}
+// signAttributes signs the DER encoded signed attributes with the configured signer.
+func (context *SignContext) signAttributes(signed_attributes []byte) ([]byte, error) {
+	if context.SignData.Signer == nil {
+		return nil, fmt.Errorf("signer is required")
+	}
 
-		return nil, errors.New("non success response (" + strconv.Itoa(code) + ")")
+	// EdDSA hashes as part of the signing algorithm.
+	if isPureEdDSA(context.SignData.Certificate) {
+		return context.SignData.Signer.Sign(rand.Reader, signed_attributes, crypto.Hash(0))
 	}
 
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	timestamp_response_body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	hash := context.SignData.DigestAlgorithm.New()
+	hash.Write(signed_attributes)
+
+	if context.SignData.RSAPSS {
+		return context.SignData.Signer.Sign(rand.Reader, hash.Sum(nil), &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       context.SignData.DigestAlgorithm,
+		})
 	}
 
-	return timestamp_response_body, nil
+	return context.SignData.Signer.Sign(rand.Reader, hash.Sum(nil), context.SignData.DigestAlgorithm)
 }
 
 func (context *SignContext) replaceSignature() error {
@@ -439,48 +533,74 @@ func (context *SignContext) replaceSignature() error {
 		return fmt.Errorf("failed to create signature: %w", err)
 	}
 
-	dst := make([]byte, hex.EncodedLen(len(signature)))
-	hex.Encode(dst, signature)
+	return context.writeSignature(signature)
+}
 
-	if uint32(len(dst)) > context.SignatureMaxLength {
-		log.Println("Signature too long, retrying with increased buffer size.")
-		// set new base and try signing again
-		context.SignatureMaxLengthBase += (uint32(len(dst)) - context.SignatureMaxLength) + 1
-		return context.SignPDF()
-	}
+// SignatureSizeError is returned when the signature does not fit in the space
+// reserved for it, SignData.ReservedSignatureSize can be used to reserve more.
+type SignatureSizeError struct {
+	Size     int // Size of the DER encoded signature
+	Reserved int // Reserved size for the DER encoded signature
+}
 
-	if _, err := context.OutputBuffer.Seek(0, 0); err != nil {
-		return err
-	}
-	file_content := context.OutputBuffer.Buff.Bytes()
+func (e *SignatureSizeError) Error() string {
+	return fmt.Sprintf("signature of %d bytes exceeds the reserved %d bytes, increase ReservedSignatureSize", e.Size, e.Reserved)
+}
 
-	// Write the file content up to the signature
-	if _, err := context.OutputBuffer.Write(file_content[context.ByteRangeValues[0]:context.ByteRangeValues[1]]); err != nil {
-		return err
-	}
+// timestampSizeMargin is added to the timestamp token size, the serial
+// number, time and nonce of the token vary slightly in size.
+const timestampSizeMargin = 64
 
-	// Write new signature
-	if _, err := context.OutputBuffer.Write([]byte("<")); err != nil {
-		return err
+// defaultTimestampTokenSize is reserved for the timestamp token when the TSA
+// has no TokenSize, most tokens including the TSA certificate are smaller.
+// Larger tokens are handled by Sign, which signs again with the actual size.
+const defaultTimestampTokenSize = 9000
+
+// timestampSize returns the size of the timestamp token including the
+// unsigned attribute that contains it.
+func (context *SignContext) timestampSize() (int, error) {
+	token_size := context.SignData.TSA.TokenSize
+	if token_size == 0 {
+		token_size = defaultTimestampTokenSize
 	}
 
-	if _, err := context.OutputBuffer.Write([]byte(dst)); err != nil {
-		return err
+	// A document timestamp only contains the token.
+	if context.SignData.Signature.CertType == TimeStampSignature {
+		return token_size + timestampSizeMargin, nil
 	}
 
-	// Write 0s to ensure the signature remains the same size
-	zeroPadding := bytes.Repeat([]byte("0"), int(context.SignatureMaxLength)-len(dst))
-	if _, err := context.OutputBuffer.Write(zeroPadding); err != nil {
-		return err
+	timestamp_attribute, err := marshalAttribute(pkcs7.Attribute{
+		Type:  oidAttributeTimestampToken,
+		Value: asn1.RawValue{FullBytes: make([]byte, token_size)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("marshal timestamp attribute: %w", err)
 	}
 
-	if _, err := context.OutputBuffer.Write([]byte(">")); err != nil {
-		return err
+	// The unsigned attributes are wrapped in an implicit [1] SET.
+	return len(timestamp_attribute) + 4 + timestampSizeMargin, nil
+}
+
+// writeSignature writes the hex encoded signature into the /Contents placeholder.
+func (context *SignContext) writeSignature(signature []byte) error {
+	dst := make([]byte, hex.EncodedLen(len(signature)))
+	hex.Encode(dst, signature)
+
+	if uint32(len(dst)) > context.SignatureMaxLength {
+		return &SignatureSizeError{
+			Size:     len(signature),
+			Reserved: int(context.SignatureMaxLength) / 2,
+		}
 	}
 
-	if _, err := context.OutputBuffer.Write(file_content[context.ByteRangeValues[2] : context.ByteRangeValues[2]+context.ByteRangeValues[3]]); err != nil {
-		return err
+	// Patch the placeholder in place, the remaining zeros keep the signature
+	// the same size.
+	contents_start := context.ByteRangeValues[1] - context.inputSize + 1 // skip <
+	update := context.OutputBuffer.Buff.Bytes()
+	if contents_start < 1 || contents_start+int64(len(dst)) > int64(len(update)) {
+		return fmt.Errorf("signature contents are not part of the incremental update")
 	}
+	copy(update[contents_start:], dst)
 
 	return nil
 }
@@ -1,12 +1,19 @@
 package sign
 
 import (
+	"crypto"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
 )
 
 var signatureTests = []struct {
@@ -80,3 +87,86 @@ func TestCreateSignaturePlaceholder(t *testing.T) {
 		}
 	}
 }
+
+func TestSignatureSizeNetworkRounds(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	var tsaRequests atomic.Int32
+	handler := newTestTSAHandler(t)
+	tsa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsaRequests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer tsa.Close()
+
+	tests := []struct {
+		name                  string
+		reservedSignatureSize int
+		expectedTSARequests   int32
+	}{
+		// The token size is estimated, only the signature is timestamped.
+		{"estimated", 0, 1},
+		{"reserved", 8192, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tsaRequests.Store(0)
+			revocationCalls := 0
+
+			err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				DigestAlgorithm:   crypto.SHA256,
+				Signer:            pkey,
+				Certificate:       cert,
+				CertificateChains: [][]*x509.Certificate{{cert}},
+				TSA: TSA{
+					URL: tsa.URL,
+				},
+				RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+					revocationCalls++
+					return nil
+				},
+				ReservedSignatureSize: tt.reservedSignatureSize,
+			})
+			if err != nil {
+				t.Fatalf("failed to sign: %s", err.Error())
+			}
+
+			if got := tsaRequests.Load(); got != tt.expectedTSARequests {
+				t.Errorf("expected %d TSA requests, got %d", tt.expectedTSARequests, got)
+			}
+			if revocationCalls != 1 {
+				t.Errorf("expected 1 revocation call, got %d", revocationCalls)
+			}
+		})
+	}
+}
+
+func TestSignatureSizeExceeded(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm:       crypto.SHA256,
+		Signer:                pkey,
+		Certificate:           cert,
+		ReservedSignatureSize: 100,
+	})
+
+	var sizeError *SignatureSizeError
+	if !errors.As(err, &sizeError) {
+		t.Fatalf("expected SignatureSizeError, got %v", err)
+	}
+	if sizeError.Reserved != 100 {
+		t.Errorf("expected 100 reserved bytes, got %d", sizeError.Reserved)
+	}
+}
@@ -102,7 +102,11 @@ func (context *SignContext) createVisualSignature(visible bool, pageNumber uint3
 	// Define the field type as a signature.
 	visual_signature.WriteString("  /FT /Sig\n")
 	// Set a unique title for the signature field.
-	visual_signature.WriteString(fmt.Sprintf("  /T %s\n", pdfString("Signature "+strconv.Itoa(len(context.existingSignatures)+1))))
+	visual_signature.WriteString(fmt.Sprintf("  /T %s\n", context.encryptText(context.getNextObjectID(), "Signature "+strconv.Itoa(len(context.existingSignatures)+1))))
+
+	// The fields that are locked when the field is signed, matching the
+	// FieldMDP transform of the signature.
+	visual_signature.WriteString(context.createLock(context.getNextObjectID()))
 
 	// Reference the signature dictionary.
 	visual_signature.WriteString(fmt.Sprintf("  /V %d 0 R\n", context.SignData.objectId))
@@ -113,7 +117,9 @@ func (context *SignContext) createVisualSignature(visible bool, pageNumber uint3
 	return visual_signature.Bytes(), nil
 }
 
-func (context *SignContext) createIncPageUpdate(pageNumber, annot uint32) ([]byte, error) {
+// createIncPageUpdate creates a copy of the page with the annotations added to
+// its /Annots array.
+func (context *SignContext) createIncPageUpdate(pageNumber uint32, annots ...uint32) ([]byte, error) {
 	var page_buffer bytes.Buffer
 
 	// Retrieve the root object from the PDF trailer.
@@ -123,6 +129,8 @@ func (context *SignContext) createIncPageUpdate(pageNumber, annot uint32) ([]byt
 		return nil, err
 	}
 
+	page_ptr := page.GetPtr()
+
 	page_buffer.WriteString("<<\n")
 
 	// TODO: Update digitorus/pdf to get raw values without resolving pointers
@@ -153,15 +161,27 @@ func (context *SignContext) createIncPageUpdate(pageNumber, annot uint32) ([]byt
 				ptr := page.Key(key).Index(i).GetPtr()
 				page_buffer.WriteString(fmt.Sprintf("    %d 0 R\n", ptr.GetID()))
 			}
-			page_buffer.WriteString(fmt.Sprintf("    %d 0 R\n", annot))
+			for _, annot := range annots {
+				page_buffer.WriteString(fmt.Sprintf("    %d 0 R\n", annot))
+			}
 			page_buffer.WriteString("  ]\n")
 		default:
-			page_buffer.WriteString(fmt.Sprintf("  /%s %s\n", key, page.Key(key).String()))
+			// The strings of the page are encrypted again for the updated page.
+			page_buffer.WriteString(fmt.Sprintf("  /%s ", key))
+			context.serializeCatalogEntry(&page_buffer, page_ptr.GetID(), page_ptr.GetID(), page.Key(key))
+			page_buffer.WriteString("\n")
 		}
 	}
 
 	if page.Key("Annots").IsNull() {
-		page_buffer.WriteString(fmt.Sprintf("  /Annots [%d 0 R]\n", annot))
+		page_buffer.WriteString("  /Annots [")
+		for i, annot := range annots {
+			if i > 0 {
+				page_buffer.WriteString(" ")
+			}
+			page_buffer.WriteString(fmt.Sprintf("%d 0 R", annot))
+		}
+		page_buffer.WriteString("]\n")
 	}
 
 	page_buffer.WriteString(">>\n")
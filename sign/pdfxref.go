@@ -41,7 +41,7 @@ func (context *SignContext) addObject(object []byte) (uint32, error) {
 	objectID := context.lastXrefID + uint32(len(context.newXrefEntries)) + 1
 	context.newXrefEntries = append(context.newXrefEntries, xrefEntry{
 		ID:     objectID,
-		Offset: int64(context.OutputBuffer.Buff.Len()) + 1,
+		Offset: context.inputSize + int64(context.OutputBuffer.Buff.Len()) + 1,
 	})
 
 	err := context.writeObject(objectID, object)
@@ -55,7 +55,7 @@ func (context *SignContext) addObject(object []byte) (uint32, error) {
 func (context *SignContext) updateObject(id uint32, object []byte) error {
 	context.updatedXrefEntries = append(context.updatedXrefEntries, xrefEntry{
 		ID:     id,
-		Offset: int64(context.OutputBuffer.Buff.Len()) + 1,
+		Offset: context.inputSize + int64(context.OutputBuffer.Buff.Len()) + 1,
 	})
 
 	err := context.writeObject(id, object)
@@ -91,7 +91,7 @@ func (context *SignContext) writeXref() error {
 	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
 		return fmt.Errorf("failed to write newline before xref: %w", err)
 	}
-	context.NewXrefStart = int64(context.OutputBuffer.Buff.Len())
+	context.NewXrefStart = context.inputSize + int64(context.OutputBuffer.Buff.Len())
 
 	switch context.PDFReader.XrefInformation.Type {
 	case "table":
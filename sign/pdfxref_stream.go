@@ -123,6 +123,14 @@ func writeXrefStreamHeader(buffer *bytes.Buffer, context *SignContext, streamLen
 
 	fmt.Fprintf(buffer, "  /Root %d 0 R\n", context.CatalogData.ObjectId)
 
+	// The incremental update is encrypted with the same encryption dictionary.
+	if context.encryption != nil {
+		if context.encryption.ObjectID == 0 {
+			return &UnsupportedEncryptionError{Reason: "direct encryption dictionary in cross-reference stream"}
+		}
+		fmt.Fprintf(buffer, "  /Encrypt %d %d R\n", context.encryption.ObjectID, context.encryption.Generation)
+	}
+
 	if !id.IsNull() {
 		id0 := hex.EncodeToString([]byte(id.Index(0).RawString()))
 		id1 := hex.EncodeToString([]byte(id.Index(1).RawString()))
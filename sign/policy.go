@@ -0,0 +1,106 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+	"github.com/digitorus/pkcs7"
+)
+
+var (
+	// RFC 5126, 5.8.1
+	oidAttributeSignaturePolicy = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 15}
+	oidSPQualifierURI           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 5, 1}
+	oidSPQualifierUserNotice    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 5, 2}
+)
+
+// SignaturePolicy identifies the signature policy of a PAdES-EPES signature,
+// it is added as the signature-policy-identifier signed attribute (ETSI EN
+// 319 122-1, 5.2.9.1).
+type SignaturePolicy struct {
+	// OID identifies the signature policy.
+	OID asn1.ObjectIdentifier
+
+	// Hash is the digest of the policy document calculated with
+	// HashAlgorithm, SHA-256 when zero.
+	HashAlgorithm crypto.Hash
+	Hash          []byte
+
+	// URI is the location of the policy document and UserNotice a text to
+	// display to the user, they are added as policy qualifiers when set.
+	URI        string
+	UserNotice string
+}
+
+// signaturePolicyID is SignaturePolicyId (RFC 5126, 5.8.1).
+type signaturePolicyID struct {
+	SigPolicyID         asn1.ObjectIdentifier
+	SigPolicyHash       otherHashAlgAndValue
+	SigPolicyQualifiers []sigPolicyQualifierInfo `asn1:"optional"`
+}
+
+type otherHashAlgAndValue struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashValue     []byte
+}
+
+type sigPolicyQualifierInfo struct {
+	SigPolicyQualifierID asn1.ObjectIdentifier
+	SigQualifier         asn1.RawValue
+}
+
+// attribute returns the signature-policy-identifier attribute.
+func (policy *SignaturePolicy) attribute() (pkcs7.Attribute, error) {
+	hash := policy.HashAlgorithm
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	hash_oid := algorithm.OIDFromHash(hash)
+	if hash_oid == nil {
+		return pkcs7.Attribute{}, fmt.Errorf("unsupported signature policy hash algorithm %s", hash)
+	}
+	if len(policy.OID) == 0 {
+		return pkcs7.Attribute{}, fmt.Errorf("signature policy OID is required")
+	}
+	if len(policy.Hash) != hash.Size() {
+		return pkcs7.Attribute{}, fmt.Errorf("signature policy hash must be a %s digest", hash)
+	}
+
+	value := signaturePolicyID{
+		SigPolicyID: policy.OID,
+		SigPolicyHash: otherHashAlgAndValue{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hash_oid},
+			HashValue:     policy.Hash,
+		},
+	}
+
+	if policy.URI != "" {
+		uri, err := asn1.MarshalWithParams(policy.URI, "ia5")
+		if err != nil {
+			return pkcs7.Attribute{}, fmt.Errorf("marshal signature policy URI: %w", err)
+		}
+		value.SigPolicyQualifiers = append(value.SigPolicyQualifiers, sigPolicyQualifierInfo{
+			SigPolicyQualifierID: oidSPQualifierURI,
+			SigQualifier:         asn1.RawValue{FullBytes: uri},
+		})
+	}
+
+	if policy.UserNotice != "" {
+		// SPUserNotice with only the explicitText.
+		notice, err := asn1.Marshal(struct {
+			ExplicitText string `asn1:"utf8"`
+		}{policy.UserNotice})
+		if err != nil {
+			return pkcs7.Attribute{}, fmt.Errorf("marshal signature policy user notice: %w", err)
+		}
+		value.SigPolicyQualifiers = append(value.SigPolicyQualifiers, sigPolicyQualifierInfo{
+			SigPolicyQualifierID: oidSPQualifierUserNotice,
+			SigQualifier:         asn1.RawValue{FullBytes: notice},
+		})
+	}
+
+	return pkcs7.Attribute{Type: oidAttributeSignaturePolicy, Value: value}, nil
+}
@@ -0,0 +1,106 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/asn1"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignSignaturePolicy(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	policy_hash := sha256.Sum256([]byte("signature policy document"))
+	policy := &SignaturePolicy{
+		OID:        asn1.ObjectIdentifier{2, 16, 724, 1, 3, 1, 1, 2, 1, 9},
+		Hash:       policy_hash[:],
+		URI:        "https://example.com/policy.pdf",
+		UserNotice: "Signed under the example policy",
+	}
+
+	output := t.TempDir() + "/signed.pdf"
+	err := SignFile("../testfiles/testfile20.pdf", output, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+			PAdES:    true,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+		SignaturePolicy: policy,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+
+	verifyPolicy := func(policies map[string][]byte) *verify.Response {
+		t.Helper()
+
+		file, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		options := verify.DefaultVerifyOptions()
+		options.SignaturePolicies = policies
+		response, err := verify.VerifyFileWithOptions(file, options)
+		if err != nil {
+			t.Fatalf("failed to verify: %s", err)
+		}
+		if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+			t.Fatalf("expected a valid signature, got %+v", response)
+		}
+		return response
+	}
+
+	response := verifyPolicy(map[string][]byte{policy.OID.String(): policy_hash[:]})
+	parsed := response.Signers[0].SignaturePolicy
+	if parsed == nil {
+		t.Fatal("expected a signature policy")
+	}
+	if parsed.OID != policy.OID.String() || parsed.HashAlgorithm != "SHA-256" || parsed.URI != policy.URI || parsed.UserNotice != policy.UserNotice {
+		t.Errorf("unexpected signature policy %+v", parsed)
+	}
+	if !parsed.HashVerified || strings.Contains(response.Error, "policy") {
+		t.Errorf("expected a verified policy hash, got %q", response.Error)
+	}
+
+	// Without a local hash the policy is reported but not verified.
+	response = verifyPolicy(nil)
+	if response.Signers[0].SignaturePolicy == nil || response.Signers[0].SignaturePolicy.HashVerified {
+		t.Error("expected an unverified signature policy")
+	}
+
+	other_hash := sha256.Sum256([]byte("other policy document"))
+	response = verifyPolicy(map[string][]byte{policy.OID.String(): other_hash[:]})
+	if response.Signers[0].SignaturePolicy.HashVerified || !strings.Contains(response.Error, "signature policy") {
+		t.Errorf("expected a signature policy error, got %q", response.Error)
+	}
+}
+
+func TestSignaturePolicyErrors(t *testing.T) {
+	hash := sha256.Sum256(nil)
+
+	tests := []struct {
+		name   string
+		policy SignaturePolicy
+	}{
+		{"missing OID", SignaturePolicy{Hash: hash[:]}},
+		{"missing hash", SignaturePolicy{OID: asn1.ObjectIdentifier{1, 2, 3}}},
+		{"hash length", SignaturePolicy{OID: asn1.ObjectIdentifier{1, 2, 3}, Hash: hash[:], HashAlgorithm: crypto.SHA512}},
+		{"hash algorithm", SignaturePolicy{OID: asn1.ObjectIdentifier{1, 2, 3}, Hash: hash[:16], HashAlgorithm: crypto.MD5}},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.policy.attribute(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -7,12 +7,22 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/digitorus/pdfsign/revocation"
 	"golang.org/x/crypto/ocsp"
 )
 
-func embedOCSPRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+func embedOCSPRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival, cache revocation.Cache) error {
+	cache_key := revocation.OCSPCacheKey(cert, issuer)
+	if cache != nil {
+		if body, ok := cache.Get(cache_key); ok {
+			if _, err := ocsp.ParseResponseForCert(body, cert, issuer); err == nil {
+				return i.AddOCSP(body)
+			}
+		}
+	}
+
 	req, err := ocsp.CreateRequest(cert, issuer, nil)
 	if err != nil {
 		return err
@@ -34,17 +44,30 @@ func embedOCSPRevocationStatus(cert, issuer *x509.Certificate, i *revocation.Inf
 	}
 
 	// check if we got a valid OCSP response
-	_, err = ocsp.ParseResponseForCert(body, cert, issuer)
+	ocsp_response, err := ocsp.ParseResponseForCert(body, cert, issuer)
 	if err != nil {
 		return err
 	}
 
+	if cache != nil {
+		if expires := revocation.Expiry(resp.Header, ocsp_response.NextUpdate, time.Now()); !expires.IsZero() {
+			_ = cache.Set(cache_key, body, expires)
+		}
+	}
+
 	return i.AddOCSP(body)
 }
 
 // embedCRLRevocationStatus requires an issuer as it needs to implement the
 // the interface, a nil argment might be given if the issuer is not known.
-func embedCRLRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+func embedCRLRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival, cache revocation.Cache) error {
+	cache_key := revocation.CRLCacheKey(cert.CRLDistributionPoints[0])
+	if cache != nil {
+		if body, ok := cache.Get(cache_key); ok {
+			return i.AddCRL(body)
+		}
+	}
+
 	resp, err := http.Get(cert.CRLDistributionPoints[0])
 	if err != nil {
 		return err
@@ -57,11 +80,33 @@ func embedCRLRevocationStatus(cert, issuer *x509.Certificate, i *revocation.Info
 		return err
 	}
 
+	if cache != nil {
+		// Only well-formed CRLs are cached.
+		if crl, err := x509.ParseRevocationList(body); err == nil {
+			if expires := revocation.Expiry(resp.Header, crl.NextUpdate, time.Now()); !expires.IsZero() {
+				_ = cache.Set(cache_key, body, expires)
+			}
+		}
+	}
+
 	// TODO: verify crl and certificate before embedding
 	return i.AddCRL(body)
 }
 
 func DefaultEmbedRevocationStatusFunction(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	return embedRevocationStatus(cert, issuer, i, nil)
+}
+
+// NewEmbedRevocationStatusFunction returns DefaultEmbedRevocationStatusFunction
+// backed by the cache, OCSP responses and CRLs are downloaded once and reused
+// until their nextUpdate or the expiry of the HTTP cache headers.
+func NewEmbedRevocationStatusFunction(cache revocation.Cache) RevocationFunction {
+	return func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+		return embedRevocationStatus(cert, issuer, i, cache)
+	}
+}
+
+func embedRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival, cache revocation.Cache) error {
 	// For each certificate a revoction status needs to be included, this can be done
 	// by embedding a CRL or OCSP response. In most cases an OCSP response is smaller
 	// to embed in the document but and empty CRL (often seen of dediced high volume
@@ -71,12 +116,11 @@ func DefaultEmbedRevocationStatusFunction(cert, issuer *x509.Certificate, i *rev
 	// compatibility.
 	//
 	// TODO: Find and embed link about compatibility
-	// TODO: Implement revocation status caching (required for higher volume signing)
 
 	// using an OCSP server
 	// OCSP requires issuer certificate.
 	if issuer != nil && len(cert.OCSPServer) > 0 {
-		err := embedOCSPRevocationStatus(cert, issuer, i)
+		err := embedOCSPRevocationStatus(cert, issuer, i, cache)
 		if err != nil {
 			return err
 		}
@@ -84,7 +128,7 @@ func DefaultEmbedRevocationStatusFunction(cert, issuer *x509.Certificate, i *rev
 
 	// using a crl
 	if len(cert.CRLDistributionPoints) > 0 {
-		err := embedCRLRevocationStatus(cert, issuer, i)
+		err := embedCRLRevocationStatus(cert, issuer, i, cache)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,98 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestNewEmbedRevocationStatusFunction(t *testing.T) {
+	ca_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca_template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca_der, err := x509.CreateCertificate(rand.Reader, ca_template, ca_template, ca_key.Public(), ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(ca_der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(12345)}
+
+	ocsp_response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, issuer, ca_key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ocsp_requests, crl_requests := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ocsp/") {
+			ocsp_requests++
+			w.Header().Set("Cache-Control", "max-age=600")
+			_, _ = w.Write(ocsp_response)
+			return
+		}
+		// The CRL must not be cached.
+		crl_requests++
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(crl)
+	}))
+	defer server.Close()
+
+	cert.OCSPServer = []string{server.URL + "/ocsp"}
+	cert.CRLDistributionPoints = []string{server.URL + "/ca.crl"}
+
+	embed := NewEmbedRevocationStatusFunction(revocation.NewMemoryCache())
+	for i := 0; i < 3; i++ {
+		var info revocation.InfoArchival
+		if err := embed(cert, issuer, &info); err != nil {
+			t.Fatal(err)
+		}
+		if len(info.OCSP) != 1 || len(info.CRL) != 1 {
+			t.Fatalf("expected an OCSP response and a CRL, got %d and %d", len(info.OCSP), len(info.CRL))
+		}
+	}
+
+	if ocsp_requests != 1 {
+		t.Errorf("expected a single OCSP request, got %d", ocsp_requests)
+	}
+	if crl_requests != 3 {
+		t.Errorf("expected a CRL request for each signature, got %d", crl_requests)
+	}
+}
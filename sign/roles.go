@@ -0,0 +1,77 @@
+package sign
+
+import (
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/digitorus/pkcs7"
+)
+
+var (
+	// ETSI EN 319 122-1, 5.2.6.1
+	oidAttributeSignerAttributesV2 = asn1.ObjectIdentifier{0, 4, 0, 19122, 1, 1}
+
+	// X.520 role attribute type.
+	oidAttributeRole = asn1.ObjectIdentifier{2, 5, 4, 72}
+)
+
+// signerAttributesAttribute returns the signer-attributes-v2 attribute with
+// the claimed roles as X.520 role attributes and the attribute certificates.
+func (context *SignContext) signerAttributesAttribute() (*pkcs7.Attribute, error) {
+	if len(context.SignData.ClaimedRoles) == 0 && len(context.SignData.CertifiedRoles) == 0 {
+		return nil, nil
+	}
+
+	// SignerAttributeV2 ::= SEQUENCE { claimedAttributes [0],
+	// certifiedAttributesV2 [1], signedAssertions [2] }, the module uses
+	// explicit tags so each field wraps a SEQUENCE OF.
+	var signer_attributes []asn1.RawValue
+
+	if len(context.SignData.ClaimedRoles) > 0 {
+		var claimed []asn1.RawValue
+		for _, role := range context.SignData.ClaimedRoles {
+			value, err := asn1.MarshalWithParams(role, "utf8")
+			if err != nil {
+				return nil, fmt.Errorf("marshal claimed role: %w", err)
+			}
+			attribute, err := asn1.Marshal(struct {
+				Type   asn1.ObjectIdentifier
+				Values []asn1.RawValue `asn1:"set"`
+			}{
+				Type:   oidAttributeRole,
+				Values: []asn1.RawValue{{FullBytes: value}},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("marshal claimed role: %w", err)
+			}
+			claimed = append(claimed, asn1.RawValue{FullBytes: attribute})
+		}
+
+		claimed_attributes, err := asn1.Marshal(claimed)
+		if err != nil {
+			return nil, fmt.Errorf("marshal claimed attributes: %w", err)
+		}
+		signer_attributes = append(signer_attributes, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: claimed_attributes})
+	}
+
+	if len(context.SignData.CertifiedRoles) > 0 {
+		// CertifiedAttributesV2 ::= SEQUENCE OF CHOICE { attributeCertificate
+		// [0], otherAttributeCertificate [1] }.
+		var certified []asn1.RawValue
+		for _, certificate := range context.SignData.CertifiedRoles {
+			var sequence asn1.RawValue
+			if rest, err := asn1.Unmarshal(certificate, &sequence); err != nil || len(rest) > 0 || sequence.Tag != asn1.TagSequence {
+				return nil, fmt.Errorf("certified role is not a DER encoded attribute certificate")
+			}
+			certified = append(certified, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificate})
+		}
+
+		certified_attributes, err := asn1.Marshal(certified)
+		if err != nil {
+			return nil, fmt.Errorf("marshal certified attributes: %w", err)
+		}
+		signer_attributes = append(signer_attributes, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: certified_attributes})
+	}
+
+	return &pkcs7.Attribute{Type: oidAttributeSignerAttributesV2, Value: signer_attributes}, nil
+}
@@ -0,0 +1,99 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignClaimedRoles(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	// Any SEQUENCE passes as attribute certificate, the content isn't parsed.
+	attribute_certificate, err := asn1.Marshal(struct{ Version int }{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := []string{"Managing Director", "Notary"}
+
+	output := t.TempDir() + "/signed.pdf"
+	err = SignFile("../testfiles/testfile20.pdf", output, SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+		ClaimedRoles:    roles,
+		CertifiedRoles:  [][]byte{attribute_certificate},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	response, err := verify.VerifyFile(file)
+	if err != nil {
+		t.Fatalf("failed to verify: %s", err)
+	}
+	if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+		t.Fatalf("expected a valid signature, got %+v", response)
+	}
+	if !reflect.DeepEqual(response.Signers[0].ClaimedRoles, roles) {
+		t.Errorf("expected roles %v, got %v", roles, response.Signers[0].ClaimedRoles)
+	}
+	if len(response.Signers[0].CertifiedRoles) != 1 || !bytes.Equal(response.Signers[0].CertifiedRoles[0], attribute_certificate) {
+		t.Errorf("expected the attribute certificate, got %x", response.Signers[0].CertifiedRoles)
+	}
+
+	err = SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+		CertifiedRoles:  [][]byte{[]byte("not DER")},
+	})
+	if err == nil {
+		t.Error("expected an error for an invalid attribute certificate")
+	}
+}
+
+func TestSignerAttributesAttribute(t *testing.T) {
+	// Encoded by OpenSSL from testfiles/asn1/signer-attributes-v2.cnf.
+	expected, err := os.ReadFile("../testfiles/asn1/signer-attributes-v2.der")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context := &SignContext{SignData: SignData{
+		ClaimedRoles:   []string{"Managing Director", "Notary"},
+		CertifiedRoles: [][]byte{{0x30, 0x03, 0x02, 0x01, 0x01}},
+	}}
+	attribute, err := context.signerAttributesAttribute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := asn1.Marshal(attribute.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(value, expected) {
+		t.Errorf("expected signer attributes %x, got %x", expected, value)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"crypto"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/algorithm"
 	"github.com/digitorus/pkcs7"
 
 	"github.com/mattetti/filebuffer"
@@ -37,7 +39,7 @@ func SignFile(input string, output string, sign_data SignData) error {
 	}
 	size := finfo.Size()
 
-	rdr, err := pdf.NewReader(input_file, size)
+	rdr, err := NewReader(input_file, size, sign_data.Password)
 	if err != nil {
 		return err
 	}
@@ -46,32 +48,79 @@ func SignFile(input string, output string, sign_data SignData) error {
 }
 
 func Sign(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, sign_data SignData) error {
+	context, err := newSignContext(input, output, rdr, size, sign_data)
+	if err != nil {
+		return err
+	}
+
+	err = context.SignPDF()
+
+	// The timestamp token is larger than the space reserved for it, the
+	// document is signed again with the size of the signature. Nothing is
+	// written to the output before the signature fits.
+	var size_err *SignatureSizeError
+	if errors.As(err, &size_err) && sign_data.ReservedSignatureSize == 0 && sign_data.TSA.URL != "" {
+		sign_data.ReservedSignatureSize = size_err.Size + timestampSizeMargin
+		if sign_data.ContentTimestamp {
+			sign_data.ReservedSignatureSize += timestampSizeMargin
+		}
+
+		context, err = newSignContext(input, output, rdr, size, sign_data)
+		if err != nil {
+			return err
+		}
+		err = context.SignPDF()
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func newSignContext(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, sign_data SignData) (*SignContext, error) {
 	sign_data.objectId = uint32(rdr.XrefInformation.ItemCount) + 2
 
-	context := SignContext{
+	context := &SignContext{
 		PDFReader:              rdr,
 		InputFile:              input,
 		OutputFile:             output,
 		SignData:               sign_data,
 		SignatureMaxLengthBase: uint32(hex.EncodedLen(512)),
+		inputSize:              size,
 	}
 
 	// Fetch existing signatures
 	existingSignatures, err := context.fetchExistingSignatures()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	context.existingSignatures = existingSignatures
 
-	err = context.SignPDF()
-	if err != nil {
-		return err
+	if err := context.initEncryption(sign_data.Password); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return context, nil
 }
 
 func (context *SignContext) SignPDF() error {
+	if err := context.preparePDF(); err != nil {
+		return err
+	}
+
+	// Replace signature
+	if err := context.replaceSignature(); err != nil {
+		return fmt.Errorf("failed to replace signature: %w", err)
+	}
+
+	// Write final output
+	return context.writeOutput()
+}
+
+// preparePDF writes the incremental update with the signature placeholder and
+// the final ByteRange.
+func (context *SignContext) preparePDF() error {
 	// set defaults
 	if context.SignData.Signature.CertType == 0 {
 		context.SignData.Signature.CertType = 1
@@ -82,26 +131,29 @@ func (context *SignContext) SignPDF() error {
 	if !context.SignData.DigestAlgorithm.Available() {
 		context.SignData.DigestAlgorithm = crypto.SHA256
 	}
+	if context.SignData.Certificate != nil && publicKeyAlgorithm(context.SignData.Certificate).Equal(oidEd25519) {
+		// RFC 8419, 3.1: Ed25519 shall be used with SHA-512 message digests.
+		context.SignData.DigestAlgorithm = crypto.SHA512
+	}
 	if context.SignData.Appearance.Page == 0 {
 		context.SignData.Appearance.Page = 1
 	}
 
-	context.OutputBuffer = filebuffer.New([]byte{})
-
-	// Copy old file into new buffer.
-	_, err := context.InputFile.Seek(0, 0)
-	if err != nil {
-		return err
-	}
-	if _, err := io.Copy(context.OutputBuffer, context.InputFile); err != nil {
+	if err := context.checkDocMDP(); err != nil {
 		return err
 	}
 
+	// The buffer only holds the incremental update, the input file is
+	// streamed to the output when the signature is complete.
+	context.OutputBuffer = filebuffer.New([]byte{})
+
 	// File always needs an empty line after %%EOF.
 	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
 		return err
 	}
 
+	var err error
+
 	// Base size for signature.
 	context.SignatureMaxLength = context.SignatureMaxLengthBase
 
@@ -111,21 +163,21 @@ func (context *SignContext) SignPDF() error {
 			return fmt.Errorf("certificate is required")
 		}
 
-		switch context.SignData.Certificate.SignatureAlgorithm.String() {
-		case "SHA1-RSA":
-		case "ECDSA-SHA1":
-		case "DSA-SHA1":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(128))
-		case "SHA256-RSA":
-		case "ECDSA-SHA256":
-		case "DSA-SHA256":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(256))
-		case "SHA384-RSA":
-		case "ECDSA-SHA384":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(384))
-		case "SHA512-RSA":
-		case "ECDSA-SHA512":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(512))
+		// EdDSA signatures need a digest algorithm that matches the curve.
+		if publicKeyAlgorithm(context.SignData.Certificate).Equal(oidEd448) {
+			return fmt.Errorf("signing with Ed448 requires SHAKE256 message digests (RFC 8419), which are not supported")
+		}
+
+		// Add size of the signature value, based on the key of the signer.
+		context.SignatureMaxLength += uint32(hex.EncodedLen(signatureSize(context.SignData.Certificate)))
+
+		// Add size of the RSASSA-PSS parameters.
+		if context.SignData.RSAPSS {
+			pss, err := algorithm.PSSAlgorithmIdentifier(context.SignData.DigestAlgorithm, context.SignData.DigestAlgorithm.Size())
+			if err != nil {
+				return err
+			}
+			context.SignatureMaxLength += uint32(hex.EncodedLen(len(pss.Parameters.FullBytes)))
 		}
 
 		// Add size of digest algorithm twice (for file digist and signing certificate attribute)
@@ -159,20 +211,58 @@ func (context *SignContext) SignPDF() error {
 			}
 		}
 
+		if err := context.checkFieldMDP(); err != nil {
+			return err
+		}
+
+		if context.SignData.ContentTimestamp && context.SignData.TSA.URL == "" {
+			return fmt.Errorf("TSA URL is required for a content timestamp")
+		}
+
+		// Add size of the custom signed and unsigned attributes, the unsigned
+		// attributes are wrapped in an implicit [1] SET.
+		extra_attributes, err := context.extraSignedAttributes()
+		if err != nil {
+			return err
+		}
+		signed_size, err := attributesSize(extra_attributes)
+		if err != nil {
+			return err
+		}
+		unsigned_size, err := attributesSize(context.SignData.UnsignedAttributes)
+		if err != nil {
+			return err
+		}
+		if unsigned_size > 0 {
+			unsigned_size += 4
+		}
+		context.SignatureMaxLength += uint32(hex.EncodedLen(signed_size + unsigned_size))
+
 		// Fetch revocation data before adding signature placeholder.
 		// Revocation data can be quite large and we need to create enough space in the placeholder.
-		if err := context.fetchRevocationData(); err != nil {
-			return fmt.Errorf("failed to fetch revocation data: %w", err)
+		// PAdES signatures don't embed revocation data in the signature.
+		if !context.SignData.Signature.PAdES {
+			if err := context.fetchRevocationData(); err != nil {
+				return fmt.Errorf("failed to fetch revocation data: %w", err)
+			}
 		}
 	}
 
-	// Add estimated size for TSA.
-	// We can't kow actual size of TSA until after signing.
-	//
-	// Different TSA servers provide different response sizes, we
-	// might need to make this configurable or detect and store.
-	if context.SignData.TSA.URL != "" {
-		context.SignatureMaxLength += uint32(hex.EncodedLen(9000))
+	if context.SignData.ReservedSignatureSize > 0 {
+		// Explicit size, no need to estimate the timestamp token.
+		context.SignatureMaxLength = uint32(hex.EncodedLen(context.SignData.ReservedSignatureSize))
+	} else if context.SignData.TSA.URL != "" {
+		// Different TSA servers provide different response sizes, the
+		// timestamp token is not known until after signing.
+		timestamp_size, err := context.timestampSize()
+		if err != nil {
+			return err
+		}
+		// The content timestamp is a signed attribute of the same size.
+		if context.SignData.ContentTimestamp && context.SignData.Signature.CertType != TimeStampSignature {
+			timestamp_size *= 2
+		}
+		context.SignatureMaxLength += uint32(hex.EncodedLen(timestamp_size))
 	}
 
 	// Create the signature object
@@ -191,41 +281,49 @@ func (context *SignContext) SignPDF() error {
 		return fmt.Errorf("failed to add signature object: %w", err)
 	}
 
-	// Create visual signature (visible or invisible based on CertType)
-	visible := false
-	rectangle := [4]float64{0, 0, 0, 0}
-	if context.SignData.Signature.CertType != ApprovalSignature && context.SignData.Appearance.Visible {
-		return fmt.Errorf("visible signatures are only allowed for approval signatures")
-	} else if context.SignData.Signature.CertType == ApprovalSignature && context.SignData.Appearance.Visible {
-		visible = true
-		rectangle = [4]float64{
-			context.SignData.Appearance.LowerLeftX,
-			context.SignData.Appearance.LowerLeftY,
-			context.SignData.Appearance.UpperRightX,
-			context.SignData.Appearance.UpperRightY,
+	if context.SignData.FieldName != "" {
+		// Sign into the existing signature field, it is already part of a
+		// page and the AcroForm.
+		if err := context.signExistingField(); err != nil {
+			return err
+		}
+	} else {
+		// Create visual signature (visible or invisible based on CertType)
+		visible := false
+		rectangle := [4]float64{0, 0, 0, 0}
+		if context.SignData.Signature.CertType != ApprovalSignature && context.SignData.Appearance.Visible {
+			return fmt.Errorf("visible signatures are only allowed for approval signatures")
+		} else if context.SignData.Signature.CertType == ApprovalSignature && context.SignData.Appearance.Visible {
+			visible = true
+			rectangle = [4]float64{
+				context.SignData.Appearance.LowerLeftX,
+				context.SignData.Appearance.LowerLeftY,
+				context.SignData.Appearance.UpperRightX,
+				context.SignData.Appearance.UpperRightY,
+			}
 		}
-	}
-
-	// Example usage: passing page number and default rect values
-	visual_signature, err := context.createVisualSignature(visible, context.SignData.Appearance.Page, rectangle)
-	if err != nil {
-		return fmt.Errorf("failed to create visual signature: %w", err)
-	}
-
-	// Write the new visual signature object.
-	context.VisualSignData.objectId, err = context.addObject(visual_signature)
-	if err != nil {
-		return fmt.Errorf("failed to add visual signature object: %w", err)
-	}
 
-	if context.SignData.Appearance.Visible {
-		inc_page_update, err := context.createIncPageUpdate(context.SignData.Appearance.Page, context.VisualSignData.objectId)
+		// Example usage: passing page number and default rect values
+		visual_signature, err := context.createVisualSignature(visible, context.SignData.Appearance.Page, rectangle)
 		if err != nil {
-			return fmt.Errorf("failed to create incremental page update: %w", err)
+			return fmt.Errorf("failed to create visual signature: %w", err)
 		}
-		err = context.updateObject(context.VisualSignData.pageObjectId, inc_page_update)
+
+		// Write the new visual signature object.
+		context.VisualSignData.objectId, err = context.addObject(visual_signature)
 		if err != nil {
-			return fmt.Errorf("failed to add incremental page update object: %w", err)
+			return fmt.Errorf("failed to add visual signature object: %w", err)
+		}
+
+		if context.SignData.Appearance.Visible {
+			inc_page_update, err := context.createIncPageUpdate(context.SignData.Appearance.Page, context.VisualSignData.objectId)
+			if err != nil {
+				return fmt.Errorf("failed to create incremental page update: %w", err)
+			}
+			err = context.updateObject(context.VisualSignData.pageObjectId, inc_page_update)
+			if err != nil {
+				return fmt.Errorf("failed to add incremental page update object: %w", err)
+			}
 		}
 	}
 
@@ -256,20 +354,5 @@ func (context *SignContext) SignPDF() error {
 		return fmt.Errorf("failed to update byte range: %w", err)
 	}
 
-	// Replace signature
-	if err := context.replaceSignature(); err != nil {
-		return fmt.Errorf("failed to replace signature: %w", err)
-	}
-
-	// Write final output
-	if _, err := context.OutputBuffer.Seek(0, 0); err != nil {
-		return err
-	}
-	file_content := context.OutputBuffer.Buff.Bytes()
-
-	if _, err := context.OutputFile.Write(file_content); err != nil {
-		return err
-	}
-
 	return nil
 }
@@ -1,12 +1,22 @@
 package sign
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -15,6 +25,8 @@ import (
 	"github.com/digitorus/pdf"
 	"github.com/digitorus/pdfsign/revocation"
 	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
 	"github.com/mattetti/filebuffer"
 )
 
@@ -813,3 +825,215 @@ func TestVisualSignLastPage(t *testing.T) {
 
 	verifySignedFile(t, tmpfile, originalFileName)
 }
+
+func TestSignPDFPAdES(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	inputFilePath := "../testfiles/testfile20.pdf"
+	originalFileName := filepath.Base(inputFilePath)
+
+	tmpfile, err := os.CreateTemp("", t.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		if err := os.Remove(tmpfile.Name()); err != nil {
+			t.Errorf("Failed to remove tmpfile: %v", err)
+		}
+	}()
+
+	err = SignFile(inputFilePath, tmpfile.Name(), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name:        "John Doe",
+				Location:    "Somewhere",
+				Reason:      "Test PAdES",
+				ContactInfo: "None",
+				Date:        time.Now().Local(),
+			},
+			CertType:   ApprovalSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+			PAdES:      true,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	})
+	if err != nil {
+		t.Fatalf("%s: %s", originalFileName, err.Error())
+	}
+
+	verifySignedFile(t, tmpfile, originalFileName)
+
+	signed, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.Contains(signed, []byte("/SubFilter /ETSI.CAdES.detached")) {
+		t.Error("expected /SubFilter /ETSI.CAdES.detached")
+	}
+	if bytes.Contains(signed, []byte(" /M ")) {
+		t.Error("unexpected /M entry in PAdES signature dictionary")
+	}
+
+	start := bytes.LastIndex(signed, []byte("/Contents<"))
+	end := bytes.IndexByte(signed[start:], '>')
+	contents, err := hex.DecodeString(string(signed[start+len("/Contents<") : start+end]))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	p7, err := pkcs7.Parse(bytes.TrimRight(contents, "\x00"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	attributes := map[string]bool{}
+	for _, attribute := range p7.Signers[0].AuthenticatedAttributes {
+		attributes[attribute.Type.String()] = true
+	}
+	if !attributes["1.2.840.113549.1.9.16.2.47"] {
+		t.Error("expected signing-certificate-v2 attribute")
+	}
+	if attributes["1.2.840.113549.1.9.5"] {
+		t.Error("unexpected signing-time attribute")
+	}
+	if attributes["1.2.840.113583.1.1.8"] {
+		t.Error("unexpected Adobe revocation attribute")
+	}
+}
+
+// newTestTSA starts a local RFC 3161 time-stamp authority.
+func newTestTSA(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(newTestTSAHandler(t))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestTSAHandler returns a handler for RFC 3161 time-stamp requests signed
+// by a new self-signed certificate.
+func newTestTSAHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	cert, key := newTestTSACertificate(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	return newTestTSAHandlerWith(cert, key, nil)
+}
+
+// newTestTSACertificate creates a self-signed TSA certificate with the
+// extended key usages.
+func newTestTSACertificate(t *testing.T, usages []x509.ExtKeyUsage) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate TSA key: %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TSA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           usages,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create TSA certificate: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse TSA certificate: %s", err.Error())
+	}
+
+	return cert, key
+}
+
+// newTestTSAHandlerWith returns a handler that signs time-stamps with the
+// certificate, modify can alter the token before it is signed.
+func newTestTSAHandlerWith(cert *x509.Certificate, key crypto.Signer, modify func(*timestamp.Timestamp)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req, err := timestamp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ts := timestamp.Timestamp{
+			HashAlgorithm:     req.HashAlgorithm,
+			HashedMessage:     req.HashedMessage,
+			Time:              time.Now(),
+			Nonce:             req.Nonce,
+			Policy:            asn1.ObjectIdentifier{1, 2, 3, 4, 1},
+			AddTSACertificate: req.Certificates,
+		}
+		if modify != nil {
+			modify(&ts)
+		}
+
+		resp, err := ts.CreateResponseWithOpts(cert, key, crypto.SHA256)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(resp)
+	})
+}
+
+func TestSignStreaming(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hide the io.ReaderAt implementation of bytes.Reader.
+	input_file := struct{ io.ReadSeeker }{bytes.NewReader(input)}
+
+	var output bytes.Buffer
+	err = Sign(input_file, &output, rdr, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm: crypto.SHA256,
+		Signer:          pkey,
+		Certificate:     cert,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err.Error())
+	}
+
+	// The input is written unchanged, followed by the incremental update.
+	if !bytes.HasPrefix(output.Bytes(), input) {
+		t.Fatal("signed document does not start with the input document")
+	}
+
+	tmpfile, err := os.CreateTemp(t.TempDir(), t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = tmpfile.Close()
+	}()
+	if _, err := tmpfile.Write(output.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	verifySignedFile(t, tmpfile, "testfile20.pdf")
+}
@@ -0,0 +1,264 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+const (
+	defaultTSATimeout      = 30 * time.Second
+	defaultTSARetryBackoff = time.Second
+)
+
+// tsaStatusError is returned for a non success HTTP response of a TSA.
+type tsaStatusError struct {
+	code int
+	body string
+}
+
+func (e *tsaStatusError) Error() string {
+	if e.body == "" {
+		return "non success response (" + strconv.Itoa(e.code) + ")"
+	}
+	return "non success response (" + strconv.Itoa(e.code) + "): " + e.body
+}
+
+// GetTSA requests a timestamp token for sign_content and returns the DER
+// encoded time-stamp response after it has been validated.
+func (context *SignContext) GetTSA(sign_content []byte) (timestamp_response []byte, err error) {
+	timestamp_response, _, err = context.SignData.TSA.timestamp(context.SignData.DigestAlgorithm, bytes.NewReader(sign_content))
+	return timestamp_response, err
+}
+
+// contentTimestampAttribute returns the content-time-stamp signed attribute
+// (ETSI EN 319 122-1, 5.2.8) with a timestamp token over the digest of the
+// ByteRange, it proves that the document existed before it was signed.
+func (context *SignContext) contentTimestampAttribute(content_digest []byte) (pkcs7.Attribute, error) {
+	_, ts, err := context.SignData.TSA.timestampDigest(context.SignData.DigestAlgorithm, content_digest)
+	if err != nil {
+		return pkcs7.Attribute{}, fmt.Errorf("get content timestamp: %w", err)
+	}
+
+	return pkcs7.Attribute{
+		Type:  oidAttributeContentTimestamp,
+		Value: asn1.RawValue{FullBytes: ts.RawToken},
+	}, nil
+}
+
+// getTSA requests a timestamp token for the content read from sign_reader.
+func (context *SignContext) getTSA(sign_reader io.Reader) (*timestamp.Timestamp, error) {
+	_, ts, err := context.SignData.TSA.timestamp(context.SignData.DigestAlgorithm, sign_reader)
+	return ts, err
+}
+
+// timestamp hashes the content and requests a timestamp token for it.
+func (tsa *TSA) timestamp(digest_algorithm crypto.Hash, content io.Reader) ([]byte, *timestamp.Timestamp, error) {
+	if digest_algorithm == 0 {
+		digest_algorithm = crypto.SHA256
+	}
+	if !digest_algorithm.Available() {
+		return nil, nil, fmt.Errorf("failed to create request: %w", x509.ErrUnsupportedAlgorithm)
+	}
+
+	hash := digest_algorithm.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return nil, nil, fmt.Errorf("failed to hash content: %w", err)
+	}
+
+	return tsa.timestampDigest(digest_algorithm, hash.Sum(nil))
+}
+
+// timestampDigest requests a timestamp token for the digest from each URL in
+// turn until a valid token is returned.
+func (tsa *TSA) timestampDigest(digest_algorithm crypto.Hash, digest []byte) ([]byte, *timestamp.Timestamp, error) {
+	// A positive 64-bit nonce, as generated by OpenSSL.
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	request := &timestamp.Request{
+		HashAlgorithm: digest_algorithm,
+		HashedMessage: digest,
+		Certificates:  true,
+		TSAPolicyOID:  tsa.PolicyOID,
+		Nonce:         nonce,
+	}
+	ts_request, err := request.Marshal()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	var errs []error
+	for _, url := range append([]string{tsa.URL}, tsa.FallbackURLs...) {
+		response, err := tsa.send(url, ts_request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+
+		ts, err := tsa.validate(response, request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid timestamp: %w", url, err))
+			continue
+		}
+
+		return response, ts, nil
+	}
+
+	return nil, nil, errors.Join(errs...)
+}
+
+// send posts the request to the TSA at url, repeating it with an exponential
+// backoff when the request fails with a network or server error.
+func (tsa *TSA) send(url string, ts_request []byte) ([]byte, error) {
+	backoff := tsa.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultTSARetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := tsa.post(url, ts_request)
+		if err == nil {
+			return response, nil
+		}
+
+		var status_error *tsaStatusError
+		retry := !errors.As(err, &status_error) || status_error.code >= 500 || status_error.code == http.StatusTooManyRequests
+		if !retry || attempt >= tsa.Retries {
+			return nil, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single time-stamp request.
+func (tsa *TSA) post(url string, ts_request []byte) ([]byte, error) {
+	timeout := tsa.Timeout
+	if timeout <= 0 {
+		timeout = defaultTSATimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(ts_request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/timestamp-query")
+	req.Header.Add("Content-Transfer-Encoding", "binary")
+
+	if tsa.Username != "" && tsa.Password != "" {
+		req.SetBasicAuth(tsa.Username, tsa.Password)
+	}
+
+	resp, err := tsa.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &tsaStatusError{code: resp.StatusCode, body: string(body)}
+	}
+
+	timestamp_response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return timestamp_response, nil
+}
+
+// client returns the configured HTTP client or one using TLSConfig.
+func (tsa *TSA) client() *http.Client {
+	if tsa.HTTPClient != nil {
+		return tsa.HTTPClient
+	}
+	if tsa.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tsa.TLSConfig
+		return &http.Client{Transport: transport}
+	}
+	return http.DefaultClient
+}
+
+// validate parses the time-stamp response and checks that the token answers
+// the request and is signed by a time stamping certificate.
+func (tsa *TSA) validate(timestamp_response []byte, request *timestamp.Request) (*timestamp.Timestamp, error) {
+	// Responses with a status other than granted are rejected by the parser.
+	ts, err := timestamp.ParseResponse(timestamp_response)
+	if err != nil {
+		return nil, err
+	}
+
+	if ts.Nonce == nil || ts.Nonce.Cmp(request.Nonce) != 0 {
+		return nil, errors.New("nonce does not match the request")
+	}
+	if ts.HashAlgorithm != request.HashAlgorithm || !bytes.Equal(ts.HashedMessage, request.HashedMessage) {
+		return nil, errors.New("message imprint does not match the request")
+	}
+	if len(request.TSAPolicyOID) > 0 && !ts.Policy.Equal(request.TSAPolicyOID) {
+		return nil, fmt.Errorf("policy %s does not match the requested policy %s", ts.Policy, request.TSAPolicyOID)
+	}
+
+	// The parser only verifies the signature when the token contains
+	// certificates, which was requested.
+	token, err := pkcs7.Parse(ts.RawToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	signer := token.GetOnlySigner()
+	if signer == nil {
+		return nil, errors.New("token does not contain the TSA certificate")
+	}
+
+	if ts.Time.Before(signer.NotBefore) || ts.Time.After(signer.NotAfter) {
+		return nil, errors.New("TSA certificate is not valid at the time of the timestamp")
+	}
+	time_stamping := false
+	for _, usage := range signer.ExtKeyUsage {
+		time_stamping = time_stamping || usage == x509.ExtKeyUsageTimeStamping
+	}
+	if !time_stamping {
+		return nil, errors.New("TSA certificate is not valid for time stamping")
+	}
+
+	if tsa.Roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range token.Certificates {
+			intermediates.AddCert(cert)
+		}
+		_, err := signer.Verify(x509.VerifyOptions{
+			Roots:         tsa.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   ts.Time,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("TSA certificate is not trusted: %w", err)
+		}
+	}
+
+	return ts, nil
+}
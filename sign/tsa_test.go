@@ -0,0 +1,368 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/timestamp"
+)
+
+func TestTSAValidation(t *testing.T) {
+	cert, key := newTestTSACertificate(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	tests := []struct {
+		name   string
+		tsa    TSA
+		modify func(*timestamp.Timestamp)
+		usages []x509.ExtKeyUsage
+		err    string
+	}{
+		{name: "valid", tsa: TSA{PolicyOID: asn1.ObjectIdentifier{1, 2, 3, 4, 1}, Roots: roots}},
+		{name: "nonce", modify: func(ts *timestamp.Timestamp) { ts.Nonce = big.NewInt(1) }, err: "nonce"},
+		{name: "no nonce", modify: func(ts *timestamp.Timestamp) { ts.Nonce = nil }, err: "nonce"},
+		{name: "imprint", modify: func(ts *timestamp.Timestamp) { ts.HashedMessage = make([]byte, 32) }, err: "message imprint"},
+		{name: "hash algorithm", modify: func(ts *timestamp.Timestamp) {
+			ts.HashAlgorithm = crypto.SHA384
+			ts.HashedMessage = make([]byte, 48)
+		}, err: "message imprint"},
+		{name: "policy", tsa: TSA{PolicyOID: asn1.ObjectIdentifier{1, 2, 3}}, err: "policy"},
+		{name: "no certificate", modify: func(ts *timestamp.Timestamp) { ts.AddTSACertificate = false }, err: "TSA certificate"},
+		{name: "time", modify: func(ts *timestamp.Timestamp) { ts.Time = time.Now().Add(2 * time.Hour) }, err: "not valid at the time"},
+		{name: "key usage", usages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, err: "time stamping"},
+		{name: "untrusted", tsa: TSA{Roots: x509.NewCertPool()}, err: "not trusted"},
+	}
+
+	for _, tt := range tests {
+		tsa_cert, tsa_key := cert, key
+		if tt.usages != nil {
+			tsa_cert, tsa_key = newTestTSACertificate(t, tt.usages)
+		}
+
+		server := httptest.NewServer(newTestTSAHandlerWith(tsa_cert, tsa_key, tt.modify))
+		tt.tsa.URL = server.URL
+
+		context := &SignContext{SignData: SignData{TSA: tt.tsa, DigestAlgorithm: crypto.SHA256}}
+		response, err := context.GetTSA([]byte("content"))
+		server.Close()
+
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+				continue
+			}
+			ts, err := timestamp.ParseResponse(response)
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+				continue
+			}
+			digest := sha256.Sum256([]byte("content"))
+			if !bytes.Equal(ts.HashedMessage, digest[:]) {
+				t.Errorf("%s: unexpected message imprint", tt.name)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestTSAFailover(t *testing.T) {
+	var failed, unavailable atomic.Int32
+
+	// Rejects every request without retries.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+
+	// Returns an invalid token.
+	invalid_cert, invalid_key := newTestTSACertificate(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	invalid := httptest.NewServer(newTestTSAHandlerWith(invalid_cert, invalid_key, func(ts *timestamp.Timestamp) {
+		ts.HashedMessage = make([]byte, 32)
+	}))
+	defer invalid.Close()
+
+	// Is unavailable for the first two requests.
+	handler := newTestTSAHandler(t)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable.Add(1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	context := &SignContext{SignData: SignData{
+		DigestAlgorithm: crypto.SHA256,
+		TSA: TSA{
+			URL:          failing.URL,
+			FallbackURLs: []string{invalid.URL, flaky.URL},
+			Retries:      2,
+			RetryBackoff: time.Millisecond,
+		},
+	}}
+	if _, err := context.GetTSA([]byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if failed.Load() != 1 {
+		t.Errorf("expected a single request for a client error, got %d", failed.Load())
+	}
+	if unavailable.Load() != 3 {
+		t.Errorf("expected two retries, got %d requests", unavailable.Load())
+	}
+
+	// All URLs fail, each error is reported.
+	unavailable.Store(0)
+	context.SignData.TSA.Retries = 1
+	_, err := context.GetTSA([]byte("content"))
+	if err == nil {
+		t.Fatal("expected an error when all TSAs fail")
+	}
+	for _, url := range []string{failing.URL, invalid.URL, flaky.URL} {
+		if !strings.Contains(err.Error(), url) {
+			t.Errorf("expected an error for %s, got %s", url, err)
+		}
+	}
+}
+
+func TestTSATimeout(t *testing.T) {
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer slow.Close()
+	defer close(done)
+
+	context := &SignContext{SignData: SignData{
+		DigestAlgorithm: crypto.SHA256,
+		TSA: TSA{
+			URL:     slow.URL,
+			Timeout: 50 * time.Millisecond,
+		},
+	}}
+	start := time.Now()
+	if _, err := context.GetTSA([]byte("content")); err == nil {
+		t.Error("expected a timeout")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("timeout was not applied")
+	}
+
+	// The TLS configuration is used when no client is set.
+	tls_server := httptest.NewTLSServer(newTestTSAHandler(t))
+	defer tls_server.Close()
+
+	context.SignData.TSA = TSA{URL: tls_server.URL}
+	if _, err := context.GetTSA([]byte("content")); err == nil {
+		t.Error("expected an error for an unknown TLS certificate")
+	}
+	context.SignData.TSA.TLSConfig = tls_server.Client().Transport.(*http.Transport).TLSClientConfig
+	if _, err := context.GetTSA([]byte("content")); err != nil {
+		t.Error(err)
+	}
+	context.SignData.TSA = TSA{URL: tls_server.URL, HTTPClient: tls_server.Client()}
+	if _, err := context.GetTSA([]byte("content")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignWithInvalidTimestamp(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tsa_cert, tsa_key := newTestTSACertificate(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	tsa := httptest.NewServer(newTestTSAHandlerWith(tsa_cert, tsa_key, func(ts *timestamp.Timestamp) {
+		ts.Nonce = big.NewInt(1)
+	}))
+	defer tsa.Close()
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm:       crypto.SHA256,
+		Signer:                pkey,
+		Certificate:           cert,
+		TSA:                   TSA{URL: tsa.URL},
+		ReservedSignatureSize: 8192,
+	})
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("expected a nonce error, got %v", err)
+	}
+}
+
+func TestTimestampSizeRetry(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	var requests atomic.Int32
+	handler := newTestTSAHandler(t)
+	tsa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer tsa.Close()
+
+	tests := []struct {
+		name     string
+		tsa      TSA
+		reserved int
+		requests int32
+		fails    bool
+	}{
+		// The token fits in the default size without a measurement.
+		{"default size", TSA{URL: tsa.URL}, 0, 1, false},
+		// The token doesn't fit, the document is signed again.
+		{"small token size", TSA{URL: tsa.URL, TokenSize: 100}, 0, 2, false},
+		// An explicit size isn't changed.
+		{"reserved size", TSA{URL: tsa.URL}, 1024, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+
+			output := t.TempDir() + "/signed.pdf"
+			err := SignFile("../testfiles/testfile20.pdf", output, SignData{
+				Signature: SignDataSignature{
+					CertType: ApprovalSignature,
+				},
+				DigestAlgorithm:       crypto.SHA256,
+				Signer:                pkey,
+				Certificate:           cert,
+				TSA:                   tt.tsa,
+				ReservedSignatureSize: tt.reserved,
+			})
+			if requests.Load() != tt.requests {
+				t.Errorf("expected %d TSA requests, got %d", tt.requests, requests.Load())
+			}
+
+			if tt.fails {
+				var size_err *SignatureSizeError
+				if !errors.As(err, &size_err) {
+					t.Fatalf("expected a SignatureSizeError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to sign: %s", err)
+			}
+			verifySignedBytes(t, mustReadFile(t, output))
+		})
+	}
+}
+
+func TestSignContentTimestamp(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	// The first request is the content timestamp.
+	tsa_cert, tsa_key := newTestTSACertificate(t, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	var requests atomic.Int32
+	var content_offset time.Duration
+	tsa := httptest.NewServer(newTestTSAHandlerWith(tsa_cert, tsa_key, func(ts *timestamp.Timestamp) {
+		if requests.Add(1) == 1 {
+			ts.Time = ts.Time.Add(content_offset)
+		}
+	}))
+	defer tsa.Close()
+
+	sign_and_verify := func(offset time.Duration) *verify.Response {
+		t.Helper()
+
+		requests.Store(0)
+		content_offset = offset
+
+		output := t.TempDir() + "/signed.pdf"
+		err := SignFile("../testfiles/testfile20.pdf", output, SignData{
+			Signature: SignDataSignature{
+				CertType: ApprovalSignature,
+				PAdES:    true,
+			},
+			DigestAlgorithm:  crypto.SHA256,
+			Signer:           pkey,
+			Certificate:      cert,
+			TSA:              TSA{URL: tsa.URL, TokenSize: 2048},
+			ContentTimestamp: true,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign: %s", err)
+		}
+		if requests.Load() != 2 {
+			t.Errorf("expected 2 TSA requests, got %d", requests.Load())
+		}
+
+		file, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		response, err := verify.VerifyFile(file)
+		if err != nil {
+			t.Fatalf("failed to verify: %s", err)
+		}
+		if len(response.Signers) != 1 {
+			t.Fatalf("expected a signer, got %+v", response)
+		}
+		return response
+	}
+
+	response := sign_and_verify(-time.Minute)
+	signer := response.Signers[0]
+	if !signer.ValidSignature || strings.Contains(response.Error, "content timestamp") {
+		t.Errorf("expected a valid signature, got %q", response.Error)
+	}
+	if signer.ContentTimeStamp == nil || signer.TimeStamp == nil {
+		t.Fatal("expected a content and a signature timestamp")
+	}
+	if !signer.ContentTimeStamp.Time.Before(signer.TimeStamp.Time) {
+		t.Errorf("expected the content timestamp %s before the signature timestamp %s", signer.ContentTimeStamp.Time, signer.TimeStamp.Time)
+	}
+
+	response = sign_and_verify(30 * time.Minute)
+	if !strings.Contains(response.Error, "after the signature timestamp") {
+		t.Errorf("expected an ordering error, got %q", response.Error)
+	}
+
+	err := SignFile("../testfiles/testfile20.pdf", t.TempDir()+"/signed.pdf", SignData{
+		Signature: SignDataSignature{
+			CertType: ApprovalSignature,
+		},
+		DigestAlgorithm:  crypto.SHA256,
+		Signer:           pkey,
+		Certificate:      cert,
+		ContentTimestamp: true,
+	})
+	if err == nil {
+		t.Error("expected an error without a TSA")
+	}
+}
@@ -2,12 +2,17 @@ package sign
 
 import (
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/asn1"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/pdfcrypt"
 	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
 	"github.com/mattetti/filebuffer"
 )
 
@@ -16,10 +21,46 @@ type CatalogData struct {
 	RootString string
 }
 
+// TSA configures the RFC 3161 time-stamp authority. The returned token is
+// validated before it is embedded: the status, nonce, message imprint, policy
+// and the signature and certificate of the TSA are checked.
 type TSA struct {
 	URL      string
 	Username string
 	Password string
+
+	// FallbackURLs are tried in order when URL fails, with the same
+	// credentials.
+	FallbackURLs []string
+
+	// HTTPClient sends the requests. When nil a client is created that uses
+	// TLSConfig, if set.
+	HTTPClient *http.Client
+	TLSConfig  *tls.Config
+
+	// Timeout limits each request, including reading the response. Defaults
+	// to 30 seconds.
+	Timeout time.Duration
+
+	// Retries is the number of times a request to a URL is repeated after a
+	// network error or a 5xx or 429 response, before the next URL is tried.
+	// RetryBackoff is the delay before the first retry, it doubles for each
+	// next retry and defaults to 1 second.
+	Retries      int
+	RetryBackoff time.Duration
+
+	// PolicyOID requests a TSA policy, the token must then use this policy.
+	PolicyOID asn1.ObjectIdentifier
+
+	// Roots validates the certificate chain of the TSA. When nil only the
+	// signature of the token and the time stamping usage of the TSA
+	// certificate are checked.
+	Roots *x509.CertPool
+
+	// TokenSize is the expected size of the DER encoded timestamp token, used
+	// to reserve space for it. When zero 9000 bytes are reserved, a document
+	// with a larger token is signed again with the actual size.
+	TokenSize int
 }
 
 type RevocationFunction func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error
@@ -35,6 +76,59 @@ type SignData struct {
 	RevocationFunction RevocationFunction
 	Appearance         Appearance
 
+	// ReservedSignatureSize is the number of bytes reserved for the DER
+	// encoded signature. When zero the size is estimated, see TSA.TokenSize
+	// for the size of the timestamp token.
+	ReservedSignatureSize int
+
+	// FieldName is the fully qualified name of an existing, empty signature
+	// field to sign. The field keeps its rectangle, page and widget, the
+	// appearance coordinates and page are ignored.
+	FieldName string
+
+	// Password is the user or owner password of an encrypted document. The
+	// strings and streams of the incremental update are encrypted with the
+	// key of the document.
+	Password string
+
+	// IgnoreDocMDP signs a certified document even when the signature
+	// invalidates the certification, instead of returning a DocMDPError.
+	IgnoreDocMDP bool
+
+	// RSAPSS creates an RSASSA-PSS signature (RFC 4056) instead of PKCS #1
+	// v1.5, using DigestAlgorithm for the message digest and MGF1 with a salt
+	// of the same length. The Signer must support rsa.PSSOptions.
+	RSAPSS bool
+
+	// SignaturePolicy adds the signature-policy-identifier attribute of
+	// PAdES-EPES signatures.
+	SignaturePolicy *SignaturePolicy
+
+	// CommitmentType adds the commitment-type-indication attribute, stating
+	// the legal meaning of the signature, for example
+	// CommitmentProofOfApproval.
+	CommitmentType CommitmentType
+
+	// ClaimedRoles are the roles of the signer, for example "Notary", added
+	// with the signer-attributes-v2 attribute. CertifiedRoles are DER
+	// encoded attribute certificates (RFC 5755) added to the same attribute.
+	ClaimedRoles   []string
+	CertifiedRoles [][]byte
+
+	// ContentTimestamp requests a timestamp token over the ByteRange digest
+	// from the TSA before signing and adds it as the content-time-stamp
+	// signed attribute, proving that the document existed before signing.
+	ContentTimestamp bool
+
+	// SignedAttributes are added to the signed attributes of the CMS
+	// signature. An attribute replaces the signing-time, signing certificate
+	// or Adobe revocation attribute of the same type, the content type and
+	// message digest can't be set. UnsignedAttributes are added next to the
+	// signature timestamp. Both are ignored for document timestamps, the
+	// reserved signature size includes them.
+	SignedAttributes   []pkcs7.Attribute
+	UnsignedAttributes []pkcs7.Attribute
+
 	objectId uint32
 }
 
@@ -80,10 +174,37 @@ const (
 	AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms
 )
 
+// FieldMDPAction selects the form fields that are locked by an approval
+// signature (Table 259).
+type FieldMDPAction uint
+
+const (
+	// FieldMDPActionAll locks all form fields.
+	FieldMDPActionAll FieldMDPAction = iota
+	// FieldMDPActionInclude locks only the form fields in FieldMDPFields.
+	FieldMDPActionInclude
+	// FieldMDPActionExclude locks all form fields except those in
+	// FieldMDPFields.
+	FieldMDPActionExclude
+)
+
 type SignDataSignature struct {
 	CertType   CertType
 	DocMDPPerm DocMDPPerm
 	Info       SignDataSignatureInfo
+
+	// PAdES creates a PAdES baseline signature (ETSI EN 319 142-1) using the
+	// ETSI.CAdES.detached SubFilter instead of adbe.pkcs7.detached. The Adobe
+	// revocation attribute, the signing-time attribute and the /M entry are
+	// omitted, revocation data is not embedded in the signature.
+	PAdES bool
+
+	// FieldMDPAction and FieldMDPFields select the form fields that an
+	// approval signature locks, by their fully qualified names. Include and
+	// Exclude also add a /Lock dictionary to the new signature field, an
+	// existing field keeps its own /Lock.
+	FieldMDPAction FieldMDPAction
+	FieldMDPFields []string
 }
 
 type SignDataSignatureInfo struct {
@@ -108,6 +229,13 @@ type SignContext struct {
 	SignatureMaxLength     uint32
 	SignatureMaxLengthBase uint32
 
+	// inputSize is the size of the input file, OutputBuffer only contains the
+	// incremental update that is appended to it.
+	inputSize int64
+
+	// encryption is set for encrypted documents.
+	encryption *pdfcrypt.SecurityHandler
+
 	existingSignatures []SignData
 	lastXrefID         uint32
 	newXrefEntries     []xrefEntry
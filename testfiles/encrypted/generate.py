@@ -0,0 +1,282 @@
+#!/usr/bin/env python3
+"""Generates the encrypted test documents of this directory.
+
+The documents are encrypted with the standard security handler (ISO 32000-2,
+7.6.4) implemented here, independently of the implementation in pdfsign. AES
+is provided by the openssl command. All documents have the user password
+"user" and the owner password "owner", except aes-256-owner.pdf which only
+has the owner password.
+
+    python3 generate.py
+"""
+
+import hashlib
+import struct
+import subprocess
+import zlib
+
+PADDING = bytes.fromhex(
+    "28bf4e5e4e758a4164004e56fffa01082e2e00b6d0683e802f0ca9fe6453697a"
+)
+DOCUMENT_ID = bytes.fromhex("5e1d3fa0b9a24c4f9d2b8e0c6a7f1b32")
+PERMISSIONS = -3904
+
+TITLE = b"Encrypted (test) document \\ pdfsign"
+LAST_MODIFIED = b"D:20240101000000Z"
+
+
+def rc4(key, data):
+    s = list(range(256))
+    j = 0
+    for i in range(256):
+        j = (j + s[i] + key[i % len(key)]) & 0xFF
+        s[i], s[j] = s[j], s[i]
+
+    out = bytearray()
+    i = j = 0
+    for c in data:
+        i = (i + 1) & 0xFF
+        j = (j + s[i]) & 0xFF
+        s[i], s[j] = s[j], s[i]
+        out.append(c ^ s[(s[i] + s[j]) & 0xFF])
+    return bytes(out)
+
+
+def aes(mode, key, data, iv=None):
+    command = ["openssl", "enc", "-aes-%d-%s" % (len(key) * 8, mode), "-K", key.hex(), "-nopad"]
+    if iv is not None:
+        command += ["-iv", iv.hex()]
+    return subprocess.run(command, input=data, capture_output=True, check=True).stdout
+
+
+def aes_encrypt(key, iv, data):
+    padding = 16 - len(data) % 16
+    return iv + aes("cbc", key, data + bytes([padding]) * padding, iv)
+
+
+def deterministic(*parts):
+    """Returns 16 bytes derived from parts, so the documents can be
+    regenerated byte for byte."""
+    return hashlib.sha256(b"|".join(parts)).digest()[:16]
+
+
+def pad_password(password):
+    return (password + PADDING)[:32]
+
+
+class RC4Handler:
+    """Revision 2 to 4 of the standard security handler."""
+
+    def __init__(self, version, revision, length, method, user, owner):
+        self.version = version
+        self.revision = revision
+        self.length = length
+        self.method = method
+        n = length // 8
+
+        # Algorithm 3: the owner password encrypts the padded user password.
+        owner_key = hashlib.md5(pad_password(owner)).digest()
+        if revision >= 3:
+            for _ in range(50):
+                owner_key = hashlib.md5(owner_key).digest()
+        owner_key = owner_key[:n]
+        self.o = rc4(owner_key, pad_password(user))
+        if revision >= 3:
+            for i in range(1, 20):
+                self.o = rc4(bytes(b ^ i for b in owner_key), self.o)
+
+        # Algorithm 2: the file encryption key.
+        key = hashlib.md5(
+            pad_password(user) + self.o + struct.pack("<i", PERMISSIONS) + DOCUMENT_ID
+        ).digest()
+        if revision >= 3:
+            for _ in range(50):
+                key = hashlib.md5(key[:n]).digest()
+        self.key = key[:n]
+
+        # Algorithm 4 and 5: the user password validation.
+        if revision == 2:
+            self.u = rc4(self.key, PADDING)
+        else:
+            u = rc4(self.key, hashlib.md5(PADDING + DOCUMENT_ID).digest())
+            for i in range(1, 20):
+                u = rc4(bytes(b ^ i for b in self.key), u)
+            self.u = u + deterministic(b"U", self.key)
+
+    def encrypt(self, object_id, data):
+        # Algorithm 1
+        salt = b"sAlT" if self.method == "AESV2" else b""
+        key = hashlib.md5(
+            self.key + struct.pack("<I", object_id)[:3] + b"\x00\x00" + salt
+        ).digest()[: min(len(self.key) + 5, 16)]
+        if self.method == "AESV2":
+            return aes_encrypt(key, deterministic(b"IV", struct.pack("<I", object_id), data), data)
+        return rc4(key, data)
+
+    def dictionary(self):
+        entries = b"/Filter /Standard /V %d /R %d /Length %d" % (self.version, self.revision, self.length)
+        if self.version == 4:
+            entries += (
+                b" /CF << /StdCF << /CFM /%s /AuthEvent /DocOpen /Length 16 >> >> /StmF /StdCF /StrF /StdCF"
+                % self.method.encode()
+            )
+        return b"<< %s /P %d /O <%s> /U <%s> >>" % (entries, PERMISSIONS, self.o.hex().encode(), self.u.hex().encode())
+
+
+class AES256Handler:
+    """Revision 6 of the standard security handler."""
+
+    method = "AESV3"
+
+    def __init__(self, user, owner):
+        self.key = hashlib.sha256(b"file encryption key").digest()
+
+        # Algorithm 8
+        validation_salt, key_salt = deterministic(b"user salts")[:8], deterministic(b"user salts")[8:]
+        self.u = self.hash(user, validation_salt, b"") + validation_salt + key_salt
+        self.ue = aes("cbc", self.hash(user, key_salt, b""), self.key, bytes(16))
+
+        # Algorithm 9
+        validation_salt, key_salt = deterministic(b"owner salts")[:8], deterministic(b"owner salts")[8:]
+        self.o = self.hash(owner, validation_salt, self.u) + validation_salt + key_salt
+        self.oe = aes("cbc", self.hash(owner, key_salt, self.u), self.key, bytes(16))
+
+        # Algorithm 10
+        perms = struct.pack("<i", PERMISSIONS) + b"\xff\xff\xff\xff" + b"Tadb" + b"pdfs"
+        self.perms = aes("ecb", self.key, perms)
+
+    @staticmethod
+    def hash(password, salt, user_key):
+        # Algorithm 2.B
+        k = hashlib.sha256(password + salt + user_key).digest()
+        rounds = 0
+        while True:
+            e = aes("cbc", k[:16], (password + k + user_key) * 64, k[16:32])
+            rounds += 1
+            k = [hashlib.sha256, hashlib.sha384, hashlib.sha512][int.from_bytes(e[:16], "big") % 3](e).digest()
+            if rounds >= 64 and e[-1] <= rounds - 32:
+                return k[:32]
+
+    def encrypt(self, object_id, data):
+        return aes_encrypt(self.key, deterministic(b"IV", struct.pack("<I", object_id), data), data)
+
+    def dictionary(self):
+        return (
+            b"<< /Filter /Standard /V 5 /R 6 /Length 256 "
+            b"/CF << /StdCF << /CFM /AESV3 /AuthEvent /DocOpen /Length 32 >> >> /StmF /StdCF /StrF /StdCF "
+            b"/P %d /O <%s> /U <%s> /OE <%s> /UE <%s> /Perms <%s> >>"
+            % (PERMISSIONS, self.o.hex().encode(), self.u.hex().encode(), self.oe.hex().encode(), self.ue.hex().encode(), self.perms.hex().encode())
+        )
+
+
+def literal(data):
+    escaped = data.replace(b"\\", b"\\\\").replace(b"(", b"\\(").replace(b")", b"\\)").replace(b"\r", b"\\r")
+    return b"(" + escaped + b")"
+
+
+def document(handler, xref_stream, content_size=0):
+    """Returns a single page document, the strings of the catalog, the page
+    and the document information and the content stream are encrypted.
+    Documents with a cross-reference stream store the pages and the font in
+    an object stream."""
+
+    def string(object_id, data):
+        # RC4 strings are written as hexadecimal strings like qpdf does, AES
+        # strings as literal strings.
+        if handler.method == "V2":
+            return b"<" + handler.encrypt(object_id, data).hex().encode() + b">"
+        return literal(handler.encrypt(object_id, data))
+
+    content = b"BT /F1 24 Tf 72 700 Td (Encrypted test document) Tj ET\n"
+    # Padding of the content stream for large streams.
+    while len(content) < content_size:
+        content += b"%% %d\n" % len(content)
+    content = handler.encrypt(4, zlib.compress(content))
+
+    objects = {
+        1: b"<< /Type /Catalog /Pages 2 0 R /Lang %s >>" % string(1, b"en-US"),
+        2: b"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+        3: (
+            b"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >> "
+            b"/Contents 4 0 R /PieceInfo << /pdfsign << /LastModified %s >> >> >>" % string(3, LAST_MODIFIED)
+        ),
+        4: b"<< /Length 6 0 R /Filter /FlateDecode >>\nstream\n" + content + b"\nendstream",
+        5: b"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+        6: b"%d" % len(content),
+        7: b"<< /Title %s /Producer %s >>" % (string(7, TITLE), string(7, b"generate.py")),
+        8: handler.dictionary(),
+    }
+
+    output = bytearray(b"%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+    offsets = {}
+    compressed = {}
+
+    if xref_stream:
+        # The object stream is encrypted, the objects in it are not.
+        members = [2, 5]
+        header = b" ".join(b"%d %d" % (object_id, 0) for object_id in members)
+        body = b""
+        positions = []
+        for index, object_id in enumerate(members):
+            positions.append(b"%d %d" % (object_id, len(body)))
+            body += objects.pop(object_id) + b"\n"
+            compressed[object_id] = (9, index)
+        header = b" ".join(positions) + b"\n"
+        data = handler.encrypt(9, zlib.compress(header + body))
+        objects[9] = (
+            b"<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n"
+            % (len(members), len(header), len(data))
+            + data
+            + b"\nendstream"
+        )
+
+    for object_id in sorted(objects):
+        offsets[object_id] = len(output)
+        output += b"%d 0 obj\n%s\nendobj\n" % (object_id, objects[object_id])
+
+    trailer = b"/Root 1 0 R /Info 7 0 R /Encrypt 8 0 R /ID [<%s><%s>]" % (DOCUMENT_ID.hex().encode(), DOCUMENT_ID.hex().encode())
+
+    if xref_stream:
+        # Cross-reference streams are not encrypted.
+        xref_id = max(objects) + 1
+        offsets[xref_id] = len(output)
+        entries = b"\x00\x00\x00\x00\x00\xff\xff"
+        for object_id in range(1, xref_id + 1):
+            if object_id in compressed:
+                entries += struct.pack(">BIH", 2, *compressed[object_id])
+            else:
+                entries += struct.pack(">BIH", 1, offsets[object_id], 0)
+        output += b"%d 0 obj\n<< /Type /XRef /Size %d /W [1 4 2] %s /Length %d >>\nstream\n" % (
+            xref_id,
+            xref_id + 1,
+            trailer,
+            len(entries),
+        )
+        output += entries + b"\nendstream\nendobj\n"
+        output += b"startxref\n%d\n%%%%EOF\n" % offsets[xref_id]
+    else:
+        xref = len(output)
+        output += b"xref\n0 %d\n0000000000 65535 f \n" % (len(objects) + 1)
+        for object_id in range(1, len(objects) + 1):
+            output += b"%010d 00000 n \n" % offsets[object_id]
+        output += b"trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n" % (len(objects) + 1, trailer, xref)
+
+    return bytes(output)
+
+
+def main():
+    documents = {
+        "rc4-40.pdf": document(RC4Handler(1, 2, 40, "V2", b"user", b"owner"), False),
+        "rc4-128.pdf": document(RC4Handler(2, 3, 128, "V2", b"user", b"owner"), False),
+        "rc4-128-cf.pdf": document(RC4Handler(4, 4, 128, "V2", b"user", b"owner"), False, 256 * 1024),
+        "aes-128.pdf": document(RC4Handler(4, 4, 128, "AESV2", b"user", b"owner"), False),
+        "aes-256.pdf": document(AES256Handler(b"user", b"owner"), True),
+        "aes-256-owner.pdf": document(AES256Handler(b"", b"owner"), True),
+    }
+    for name, data in documents.items():
+        with open(name, "wb") as f:
+            f.write(data)
+
+
+if __name__ == "__main__":
+    main()
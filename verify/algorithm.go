@@ -0,0 +1,102 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+	"github.com/digitorus/pkcs7"
+)
+
+// isRSAPSS reports whether the signature is RSASSA-PSS, which pkcs7 can't
+// verify.
+func isRSAPSS(p7 *pkcs7.PKCS7) bool {
+	return len(p7.Signers) == 1 && p7.Signers[0].DigestEncryptionAlgorithm.Algorithm.Equal(algorithm.OIDRSASSAPSS)
+}
+
+// verifyRSAPSS verifies an RSASSA-PSS signature the way pkcs7 verifies other
+// signatures, trusted reports whether the signer certificate chains to the
+// certificates in roots.
+func verifyRSAPSS(p7 *pkcs7.PKCS7, roots *x509.CertPool) (trusted bool, err error) {
+	signer := p7.Signers[0]
+
+	var ee *x509.Certificate
+	for _, cert := range p7.Certificates {
+		if cert.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, signer.IssuerAndSerialNumber.IssuerName.FullBytes) {
+			ee = cert
+			break
+		}
+	}
+	if ee == nil {
+		return false, errors.New("no certificate for signer")
+	}
+
+	public_key, ok := ee.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return false, errors.New("RSASSA-PSS signature with a non-RSA certificate")
+	}
+
+	hash, salt_length, err := algorithm.ParsePSSParameters(signer.DigestEncryptionAlgorithm)
+	if err != nil {
+		return false, err
+	}
+	if algorithm.HashFromOID(signer.DigestAlgorithm.Algorithm) != hash {
+		return false, errors.New("RSASSA-PSS hash differs from the digest algorithm")
+	}
+
+	var message_digest []byte
+	signing_time := time.Now().UTC()
+	for _, attr := range signer.AuthenticatedAttributes {
+		switch {
+		case attr.Type.Equal(pkcs7.OIDAttributeMessageDigest):
+			if _, err := asn1.Unmarshal(attr.Value.Bytes, &message_digest); err != nil {
+				return false, fmt.Errorf("invalid message digest: %v", err)
+			}
+		case attr.Type.Equal(pkcs7.OIDAttributeSigningTime):
+			if _, err := asn1.Unmarshal(attr.Value.Bytes, &signing_time); err != nil {
+				return false, fmt.Errorf("invalid signing time: %v", err)
+			}
+			if signing_time.After(ee.NotAfter) || signing_time.Before(ee.NotBefore) {
+				return false, fmt.Errorf("signing time %q is outside of certificate validity %q to %q",
+					signing_time.Format(time.RFC3339),
+					ee.NotBefore.Format(time.RFC3339),
+					ee.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+
+	h := hash.New()
+	h.Write(p7.Content)
+	if subtle.ConstantTimeCompare(message_digest, h.Sum(nil)) != 1 {
+		return false, errors.New("message digest mismatch")
+	}
+
+	signed_attributes, err := asn1.MarshalWithParams(signer.AuthenticatedAttributes, "set")
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal signed attributes: %v", err)
+	}
+
+	h = hash.New()
+	h.Write(signed_attributes)
+	if err := rsa.VerifyPSS(public_key, hash, h.Sum(nil), signer.EncryptedDigest, &rsa.PSSOptions{
+		SaltLength: salt_length,
+		Hash:       hash,
+	}); err != nil {
+		return false, fmt.Errorf("RSASSA-PSS: %v", err)
+	}
+
+	_, err = ee.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: roots,
+		CurrentTime:   signing_time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	return err == nil, nil
+}
@@ -0,0 +1,248 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/digitorus/pdfsign/internal/algorithm"
+	"github.com/digitorus/pkcs7"
+)
+
+var (
+	// RFC 5126, 5.8.1
+	oidAttributeSignaturePolicy = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 15}
+	oidSPQualifierURI           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 5, 1}
+	oidSPQualifierUserNotice    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 5, 2}
+
+	// ETSI EN 319 122-1, 5.2.6.1 and the signer-attributes of RFC 5126
+	oidAttributeSignerAttributesV2 = asn1.ObjectIdentifier{0, 4, 0, 19122, 1, 1}
+	oidAttributeSignerAttributes   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 18}
+	oidAttributeRole               = asn1.ObjectIdentifier{2, 5, 4, 72}
+
+	// ETSI EN 319 122-1, 5.2.8
+	oidAttributeContentTimestamp = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 20}
+
+	// ETSI EN 319 122-1, 5.2.3
+	oidAttributeCommitmentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 16}
+)
+
+// commitmentTypeNames are the commitment types of RFC 5126, 5.11.1.
+var commitmentTypeNames = map[string]string{
+	"1.2.840.113549.1.9.16.6.1": "ProofOfOrigin",
+	"1.2.840.113549.1.9.16.6.2": "ProofOfReceipt",
+	"1.2.840.113549.1.9.16.6.3": "ProofOfDelivery",
+	"1.2.840.113549.1.9.16.6.4": "ProofOfSender",
+	"1.2.840.113549.1.9.16.6.5": "ProofOfApproval",
+	"1.2.840.113549.1.9.16.6.6": "ProofOfCreation",
+}
+
+// signaturePolicyID is SignaturePolicyId (RFC 5126, 5.8.1).
+type signaturePolicyID struct {
+	SigPolicyID   asn1.ObjectIdentifier
+	SigPolicyHash struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashValue     []byte
+	}
+	SigPolicyQualifiers []struct {
+		SigPolicyQualifierID asn1.ObjectIdentifier
+		SigQualifier         asn1.RawValue
+	} `asn1:"optional"`
+}
+
+// signedAttribute returns the DER encoded value of the first signed attribute
+// of the type.
+func signedAttribute(p7 *pkcs7.PKCS7, oid asn1.ObjectIdentifier) ([]byte, bool) {
+	if len(p7.Signers) == 0 {
+		return nil, false
+	}
+	for _, attr := range p7.Signers[0].AuthenticatedAttributes {
+		if attr.Type.Equal(oid) {
+			return attr.Value.Bytes, true
+		}
+	}
+	return nil, false
+}
+
+// processSignaturePolicy parses the signature-policy-identifier attribute of
+// PAdES-EPES signatures and checks the hash of the policy document against
+// the hash in the options.
+func processSignaturePolicy(p7 *pkcs7.PKCS7, signer *Signer, options *VerifyOptions) error {
+	value, ok := signedAttribute(p7, oidAttributeSignaturePolicy)
+	if !ok {
+		return nil
+	}
+
+	// An implied policy is identified by the context, not the signature.
+	var null asn1.RawValue
+	if _, err := asn1.Unmarshal(value, &null); err == nil && null.Class == asn1.ClassUniversal && null.Tag == asn1.TagNull {
+		signer.SignaturePolicy = &SignaturePolicy{Implied: true}
+		return nil
+	}
+
+	var id signaturePolicyID
+	if _, err := asn1.Unmarshal(value, &id); err != nil {
+		return fmt.Errorf("failed to parse signature policy identifier: %v", err)
+	}
+
+	policy := &SignaturePolicy{
+		OID:  id.SigPolicyID.String(),
+		Hash: id.SigPolicyHash.HashValue,
+	}
+	if hash := algorithm.HashFromOID(id.SigPolicyHash.HashAlgorithm.Algorithm); hash != 0 {
+		policy.HashAlgorithm = hash.String()
+	} else {
+		policy.HashAlgorithm = id.SigPolicyHash.HashAlgorithm.Algorithm.String()
+	}
+
+	for _, qualifier := range id.SigPolicyQualifiers {
+		switch {
+		case qualifier.SigPolicyQualifierID.Equal(oidSPQualifierURI):
+			_, _ = asn1.Unmarshal(qualifier.SigQualifier.FullBytes, &policy.URI)
+		case qualifier.SigPolicyQualifierID.Equal(oidSPQualifierUserNotice):
+			// SPUserNotice, only the explicitText is reported.
+			var notice []asn1.RawValue
+			_, _ = asn1.Unmarshal(qualifier.SigQualifier.FullBytes, &notice)
+			for _, element := range notice {
+				if !element.IsCompound {
+					_, _ = asn1.Unmarshal(element.FullBytes, &policy.UserNotice)
+				}
+			}
+		}
+	}
+
+	signer.SignaturePolicy = policy
+
+	expected, ok := options.SignaturePolicies[policy.OID]
+	if !ok {
+		return nil
+	}
+	if !bytes.Equal(expected, policy.Hash) {
+		return fmt.Errorf("hash of signature policy %s does not match", policy.OID)
+	}
+	policy.HashVerified = true
+
+	return nil
+}
+
+// processSignerAttributes parses the claimed roles and attribute certificates
+// of the signer-attributes-v2 or signer-attributes attribute.
+func processSignerAttributes(p7 *pkcs7.PKCS7, signer *Signer) error {
+	value, v2 := signedAttribute(p7, oidAttributeSignerAttributesV2)
+	if !v2 {
+		var ok bool
+		if value, ok = signedAttribute(p7, oidAttributeSignerAttributes); !ok {
+			return nil
+		}
+	}
+
+	return parseSignerAttributes(value, v2, signer)
+}
+
+// parseSignerAttributes parses a SignerAttributeV2 (ETSI EN 319 122-1) or a
+// SignerAttribute (RFC 5126), both modules use explicit tags.
+func parseSignerAttributes(value []byte, v2 bool, signer *Signer) error {
+	var signerAttributes []asn1.RawValue
+	if _, err := asn1.Unmarshal(value, &signerAttributes); err != nil {
+		return fmt.Errorf("failed to parse signer attributes: %v", err)
+	}
+
+	for _, element := range signerAttributes {
+		if element.Class != asn1.ClassContextSpecific {
+			continue
+		}
+
+		switch element.Tag {
+		case 0:
+			// claimedAttributes, a SEQUENCE OF Attribute.
+			var claimed []struct {
+				Type   asn1.ObjectIdentifier
+				Values []asn1.RawValue `asn1:"set"`
+			}
+			if _, err := asn1.Unmarshal(element.Bytes, &claimed); err != nil {
+				return fmt.Errorf("failed to parse claimed attributes: %v", err)
+			}
+			for _, attribute := range claimed {
+				if !attribute.Type.Equal(oidAttributeRole) {
+					continue
+				}
+				for _, role := range attribute.Values {
+					if name := roleName(role); name != "" {
+						signer.ClaimedRoles = append(signer.ClaimedRoles, name)
+					}
+				}
+			}
+		case 1:
+			// certifiedAttributes is an attribute certificate,
+			// certifiedAttributesV2 a SEQUENCE OF CHOICE with the attribute
+			// certificates as attributeCertificate [0].
+			if !v2 {
+				signer.CertifiedRoles = append(signer.CertifiedRoles, element.Bytes)
+				continue
+			}
+
+			var certified []asn1.RawValue
+			if _, err := asn1.Unmarshal(element.Bytes, &certified); err != nil {
+				return fmt.Errorf("failed to parse certified attributes: %v", err)
+			}
+			for _, choice := range certified {
+				if choice.Class == asn1.ClassContextSpecific && choice.Tag == 0 {
+					signer.CertifiedRoles = append(signer.CertifiedRoles, choice.Bytes)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// roleName returns the role of a claimed role attribute value, either a
+// string or a RoleSyntax (RFC 5755, 4.4.5) with a roleName.
+func roleName(value asn1.RawValue) string {
+	var name string
+	if _, err := asn1.Unmarshal(value.FullBytes, &name); err == nil {
+		return name
+	}
+
+	var roleSyntax []asn1.RawValue
+	if _, err := asn1.Unmarshal(value.FullBytes, &roleSyntax); err != nil {
+		return ""
+	}
+	for _, element := range roleSyntax {
+		// roleName [1] GeneralName, a CHOICE so the tag is explicit.
+		if element.Class != asn1.ClassContextSpecific || element.Tag != 1 {
+			continue
+		}
+		var generalName asn1.RawValue
+		if _, err := asn1.Unmarshal(element.Bytes, &generalName); err == nil && !generalName.IsCompound {
+			return string(generalName.Bytes)
+		}
+	}
+	return ""
+}
+
+// processCommitmentType parses the commitment-type-indication attribute.
+func processCommitmentType(p7 *pkcs7.PKCS7, signer *Signer) error {
+	value, ok := signedAttribute(p7, oidAttributeCommitmentType)
+	if !ok {
+		return nil
+	}
+
+	// The commitmentTypeQualifier is not reported.
+	var indication struct {
+		CommitmentTypeID        asn1.ObjectIdentifier
+		CommitmentTypeQualifier asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(value, &indication); err != nil {
+		return fmt.Errorf("failed to parse commitment type indication: %v", err)
+	}
+
+	oid := indication.CommitmentTypeID.String()
+	signer.CommitmentType = &CommitmentType{
+		OID:  oid,
+		Name: commitmentTypeNames[oid],
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRoleName(t *testing.T) {
+	utf8, _ := asn1.MarshalWithParams("Notary", "utf8")
+
+	// RoleSyntax with a roleName [1] of uniformResourceIdentifier [6].
+	uri, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("urn:role:director")})
+	roleSyntax, _ := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: uri}})
+
+	integer, _ := asn1.Marshal(1)
+
+	tests := []struct {
+		value    []byte
+		expected string
+	}{
+		{utf8, "Notary"},
+		{roleSyntax, "urn:role:director"},
+		{integer, ""},
+	}
+
+	for _, tt := range tests {
+		if name := roleName(asn1.RawValue{FullBytes: tt.value}); name != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, name)
+		}
+	}
+}
+
+func TestParseSignerAttributes(t *testing.T) {
+	// Encoded by OpenSSL from testfiles/asn1/signer-attributes-v2.cnf.
+	value, err := os.ReadFile("../testfiles/asn1/signer-attributes-v2.der")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signer Signer
+	if err := parseSignerAttributes(value, true, &signer); err != nil {
+		t.Fatal(err)
+	}
+
+	if roles := []string{"Managing Director", "Notary"}; !reflect.DeepEqual(signer.ClaimedRoles, roles) {
+		t.Errorf("expected roles %v, got %v", roles, signer.ClaimedRoles)
+	}
+	certificate := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	if len(signer.CertifiedRoles) != 1 || !bytes.Equal(signer.CertifiedRoles[0], certificate) {
+		t.Errorf("expected the attribute certificate, got %x", signer.CertifiedRoles)
+	}
+
+	// The certifiedAttributes of a SignerAttribute are the certificate.
+	v1, _ := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: certificate}})
+	signer = Signer{}
+	if err := parseSignerAttributes(v1, false, &signer); err != nil {
+		t.Fatal(err)
+	}
+	if len(signer.CertifiedRoles) != 1 || !bytes.Equal(signer.CertifiedRoles[0], certificate) {
+		t.Errorf("expected the attribute certificate, got %x", signer.CertifiedRoles)
+	}
+}
@@ -44,6 +44,27 @@ func parseDocumentInfo(v pdf.Value, documentInfo *DocumentInfo) {
 	}
 }
 
+// parseCertificationLevel returns the P entry of the DocMDP transform
+// parameters of a signature dictionary, 2 when absent, or zero when the
+// signature has no DocMDP reference.
+func parseCertificationLevel(v pdf.Value) int {
+	references := v.Key("Reference")
+	for i := 0; i < references.Len(); i++ {
+		reference := references.Index(i)
+		if reference.Key("TransformMethod").Name() != "DocMDP" {
+			continue
+		}
+
+		level := int(reference.Key("TransformParams").Key("P").Int64())
+		if level < 1 || level > 3 {
+			return 2
+		}
+		return level
+	}
+
+	return 0
+}
+
 // parseDate parses PDF formatted dates.
 func parseDate(v string) (time.Time, error) {
 	// PDF Date Format
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/digitorus/pdfsign/revocation"
 	"golang.org/x/crypto/ocsp"
 )
 
@@ -29,6 +30,22 @@ func performExternalOCSPCheckWithFunc(cert, issuer *x509.Certificate, options *V
 		return nil, fmt.Errorf("certificate has no OCSP server URLs")
 	}
 
+	// Responses are cached per issuer, which is required to verify them
+	cache := options.RevocationCache
+	var cacheKey string
+	if issuer == nil {
+		cache = nil
+	} else {
+		cacheKey = revocation.OCSPCacheKey(cert, issuer)
+	}
+	if cache != nil {
+		if body, ok := cache.Get(cacheKey); ok {
+			if ocspResp, err := ocsp.ParseResponse(body, issuer); err == nil {
+				return ocspResp, nil
+			}
+		}
+	}
+
 	// Create OCSP request (use injected func if provided)
 	var ocspReq []byte
 	var err error
@@ -83,6 +100,12 @@ func performExternalOCSPCheckWithFunc(cert, issuer *x509.Certificate, options *V
 			continue
 		}
 
+		if cache != nil {
+			if expires := revocation.Expiry(resp.Header, ocspResp.NextUpdate, time.Now()); !expires.IsZero() {
+				_ = cache.Set(cacheKey, body, expires)
+			}
+		}
+
 		// Successfully got OCSP response
 		return ocspResp, nil
 	}
@@ -114,32 +137,9 @@ func performExternalCRLCheck(cert *x509.Certificate, options *VerifyOptions) (*t
 	// Try each CRL distribution point
 	var lastErr error
 	for _, crlURL := range cert.CRLDistributionPoints {
-		resp, err := client.Get(crlURL)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to download CRL from %s: %v", crlURL, err)
-			continue
-		}
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				// Log error but don't fail the operation
-				lastErr = fmt.Errorf("failed to close response body: %v", err)
-			}
-		}()
-
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("CRL server %s returned status %d", crlURL, resp.StatusCode)
-			continue
-		}
-
-		body, err := io.ReadAll(resp.Body)
+		crl, err := fetchCRL(client, crlURL, options.RevocationCache)
 		if err != nil {
-			lastErr = fmt.Errorf("failed to read CRL from %s: %v", crlURL, err)
-			continue
-		}
-
-		crl, err := x509.ParseRevocationList(body)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to parse CRL from %s: %v", crlURL, err)
+			lastErr = err
 			continue
 		}
 
@@ -156,3 +156,45 @@ func performExternalCRLCheck(cert *x509.Certificate, options *VerifyOptions) (*t
 
 	return nil, false, lastErr
 }
+
+// fetchCRL downloads and parses the CRL, using the cache when provided.
+func fetchCRL(client *http.Client, crlURL string, cache revocation.Cache) (*x509.RevocationList, error) {
+	cacheKey := revocation.CRLCacheKey(crlURL)
+	if cache != nil {
+		if body, ok := cache.Get(cacheKey); ok {
+			if crl, err := x509.ParseRevocationList(body); err == nil {
+				return crl, nil
+			}
+		}
+	}
+
+	resp, err := client.Get(crlURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download CRL from %s: %v", crlURL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CRL server %s returned status %d", crlURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL from %s: %v", crlURL, err)
+	}
+
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL from %s: %v", crlURL, err)
+	}
+
+	if cache != nil {
+		if expires := revocation.Expiry(resp.Header, crl.NextUpdate, time.Now()); !expires.IsZero() {
+			_ = cache.Set(cacheKey, body, expires)
+		}
+	}
+
+	return crl, nil
+}
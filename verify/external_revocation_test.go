@@ -1,12 +1,19 @@
 package verify
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
 )
 
 func TestPerformExternalOCSPCheck(t *testing.T) {
@@ -360,3 +367,79 @@ func containsStringHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestExternalRevocationCache(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(12345)}
+
+	ocspResponse, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, issuer, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/ocsp" {
+			_, _ = w.Write(ocspResponse)
+			return
+		}
+		_, _ = w.Write(crl)
+	}))
+	defer server.Close()
+
+	cert.OCSPServer = []string{server.URL + "/ocsp"}
+	cert.CRLDistributionPoints = []string{server.URL + "/ca.crl"}
+
+	options := &VerifyOptions{
+		EnableExternalRevocationCheck: true,
+		RevocationCache:               revocation.NewMemoryCache(),
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := performExternalOCSPCheck(cert, issuer, options); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := performExternalCRLCheck(cert, options); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("expected one OCSP and one CRL request, got %d requests", requests)
+	}
+}
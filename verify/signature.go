@@ -36,16 +36,31 @@ func processSignature(v pdf.Value, file io.ReaderAt, options *VerifyOptions) (Si
 		return signer, "", fmt.Errorf("failed to parse PKCS#7: %v", err)
 	}
 
-	// Process byte range for signature verification
-	err = processByteRange(v, file, p7)
-	if err != nil {
-		return signer, fmt.Sprintf("Failed to process ByteRange: %v", err), nil
-	}
+	if v.Key("SubFilter").Name() == "ETSI.RFC3161" {
+		// Document timestamp, the signed content is the TSTInfo
+		err = processDocumentTimestamp(v, file, &signer)
+		if err != nil {
+			return signer, fmt.Sprintf("Failed to process document timestamp: %v", err), nil
+		}
+	} else {
+		// Process byte range for signature verification
+		err = processByteRange(v, file, p7)
+		if err != nil {
+			return signer, fmt.Sprintf("Failed to process ByteRange: %v", err), nil
+		}
 
-	// Process timestamp if present
-	err = processTimestamp(p7, &signer)
-	if err != nil {
-		return signer, fmt.Sprintf("Failed to process timestamp: %v", err), nil
+		// Process timestamp if present
+		err = processTimestamp(p7, &signer)
+		if err != nil {
+			return signer, fmt.Sprintf("Failed to process timestamp: %v", err), nil
+		}
+
+		// Process content timestamp if present, after the signature timestamp
+		// to check their order
+		err = processContentTimestamp(p7, &signer)
+		if err != nil {
+			return signer, fmt.Sprintf("Failed to process content timestamp: %v", err), nil
+		}
 	}
 
 	// Verify the digital signature
@@ -63,6 +78,21 @@ func processSignature(v pdf.Value, file io.ReaderAt, options *VerifyOptions) (Si
 		return signer, fmt.Sprintf("Failed to build certificate chains: %v", err), nil
 	}
 
+	err = processSignaturePolicy(p7, &signer, options)
+	if err != nil && certError == "" {
+		certError = fmt.Sprintf("Failed to verify signature policy: %v", err)
+	}
+
+	err = processSignerAttributes(p7, &signer)
+	if err != nil && certError == "" {
+		certError = fmt.Sprintf("Failed to process signer attributes: %v", err)
+	}
+
+	err = processCommitmentType(p7, &signer)
+	if err != nil && certError == "" {
+		certError = fmt.Sprintf("Failed to process commitment type: %v", err)
+	}
+
 	return signer, certError, nil
 }
 
@@ -85,6 +115,31 @@ func processByteRange(v pdf.Value, file io.ReaderAt, p7 *pkcs7.PKCS7) error {
 	return nil
 }
 
+// processDocumentTimestamp checks that the message imprint of a document
+// timestamp (ETSI.RFC3161) matches the byte range.
+func processDocumentTimestamp(v pdf.Value, file io.ReaderAt, signer *Signer) error {
+	ts, err := timestamp.Parse([]byte(v.Key("Contents").RawString()))
+	if err != nil {
+		return fmt.Errorf("failed to parse timestamp: %v", err)
+	}
+
+	signer.TimeStamp = ts
+
+	h := ts.HashAlgorithm.New()
+	for i := 0; i+1 < v.Key("ByteRange").Len(); i += 2 {
+		_, err := io.Copy(h, io.NewSectionReader(file, v.Key("ByteRange").Index(i).Int64(), v.Key("ByteRange").Index(i+1).Int64()))
+		if err != nil {
+			return fmt.Errorf("failed to read byte range %d: %v", i+1, err)
+		}
+	}
+
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return fmt.Errorf("timestamp hash does not match")
+	}
+
+	return nil
+}
+
 // processTimestamp processes timestamp information from the signature.
 func processTimestamp(p7 *pkcs7.PKCS7, signer *Signer) error {
 	for _, s := range p7.Signers {
@@ -120,6 +175,35 @@ func processTimestamp(p7 *pkcs7.PKCS7, signer *Signer) error {
 	return nil
 }
 
+// processContentTimestamp processes the content-time-stamp signed attribute,
+// a timestamp over the signed content created before signing.
+func processContentTimestamp(p7 *pkcs7.PKCS7, signer *Signer) error {
+	value, ok := signedAttribute(p7, oidAttributeContentTimestamp)
+	if !ok {
+		return nil
+	}
+
+	ts, err := timestamp.Parse(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse timestamp: %v", err)
+	}
+
+	signer.ContentTimeStamp = ts
+
+	h := ts.HashAlgorithm.New()
+	h.Write(p7.Content)
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return fmt.Errorf("content timestamp hash does not match")
+	}
+
+	// The content was time-stamped before it was signed.
+	if signer.TimeStamp != nil && ts.Time.After(signer.TimeStamp.Time) {
+		return fmt.Errorf("content timestamp %s is after the signature timestamp %s", ts.Time, signer.TimeStamp.Time)
+	}
+
+	return nil
+}
+
 // verifySignature verifies the digital signature.
 func verifySignature(p7 *pkcs7.PKCS7, signer *Signer) error {
 	// Directory of certificates, including OCSP
@@ -128,6 +212,16 @@ func verifySignature(p7 *pkcs7.PKCS7, signer *Signer) error {
 		certPool.AddCert(cert)
 	}
 
+	if isRSAPSS(p7) {
+		trusted, err := verifyRSAPSS(p7, certPool)
+		if err != nil {
+			return fmt.Errorf("signature verification failed: %v", err)
+		}
+		signer.ValidSignature = true
+		signer.TrustedIssuer = trusted
+		return nil
+	}
+
 	// Verify the digital signature of the pdf file.
 	err := p7.VerifyWithChain(certPool)
 	if err != nil {
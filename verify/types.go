@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/digitorus/pdfsign/revocation"
 	"github.com/digitorus/timestamp"
 	"golang.org/x/crypto/ocsp"
 )
@@ -52,6 +53,14 @@ type VerifyOptions struct {
 	// HTTPTimeout specifies the timeout for HTTP requests during external revocation checking
 	// If zero, a default timeout of 10 seconds will be used
 	HTTPTimeout time.Duration
+
+	// RevocationCache stores the OCSP responses and CRLs of external revocation checking
+	// until their nextUpdate or HTTP cache expiry, it can be shared with the sign package
+	RevocationCache revocation.Cache
+
+	// SignaturePolicies maps signature policy OIDs to the hash of the policy document,
+	// the hash in the signature-policy-identifier attribute of a signature must match
+	SignaturePolicies map[string][]byte
 }
 
 type Response struct {
@@ -71,12 +80,34 @@ type Signer struct {
 	RevokedCertificate bool                 `json:"revoked_certificate"`
 	Certificates       []Certificate        `json:"certificates"`
 	TimeStamp          *timestamp.Timestamp `json:"time_stamp"`
+	ContentTimeStamp   *timestamp.Timestamp `json:"content_time_stamp,omitempty"`
 	SignatureTime      *time.Time           `json:"signature_time,omitempty"`   // Time from the signature object, may be untrusted
 	TimestampStatus    string               `json:"timestamp_status,omitempty"` // "valid", "invalid", "missing"
 	TimestampTrusted   bool                 `json:"timestamp_trusted"`          // Whether timestamp certificate chain is trusted
 	VerificationTime   *time.Time           `json:"verification_time"`          // Time used for certificate validation
 	TimeSource         string               `json:"time_source"`                // "embedded_timestamp", "signature_time", "current_time"
 	TimeWarnings       []string             `json:"time_warnings,omitempty"`    // Warnings about time validation
+	SignaturePolicy    *SignaturePolicy     `json:"signature_policy,omitempty"` // Signature policy of a PAdES-EPES signature
+	ClaimedRoles       []string             `json:"claimed_roles,omitempty"`    // Roles claimed by the signer in the signer attributes
+	CertifiedRoles     [][]byte             `json:"certified_roles,omitempty"`  // DER encoded attribute certificates of the signer attributes
+	CommitmentType     *CommitmentType      `json:"commitment_type,omitempty"`  // Commitment type indication of the signature
+}
+
+// CommitmentType is the commitment-type-indication attribute of a signature.
+type CommitmentType struct {
+	OID  string `json:"oid"`
+	Name string `json:"name,omitempty"` // For example "ProofOfApproval", empty for other commitment types
+}
+
+// SignaturePolicy is the signature-policy-identifier attribute of a signature.
+type SignaturePolicy struct {
+	OID           string `json:"oid,omitempty"`
+	Implied       bool   `json:"implied,omitempty"`        // The policy is implied by the context
+	HashAlgorithm string `json:"hash_algorithm,omitempty"` // Digest algorithm of the policy document hash
+	Hash          []byte `json:"hash,omitempty"`
+	URI           string `json:"uri,omitempty"`
+	UserNotice    string `json:"user_notice,omitempty"`
+	HashVerified  bool   `json:"hash_verified"` // Whether the hash matches VerifyOptions.SignaturePolicies
 }
 
 type Certificate struct {
@@ -112,4 +143,9 @@ type DocumentInfo struct {
 	Keywords     []string  `json:"keywords"`
 	ModDate      time.Time `json:"mod_date"`
 	CreationDate time.Time `json:"creation_date"`
+
+	// CertificationLevel is the DocMDP permission of the certification
+	// signature: 1 no changes, 2 form filling and signing, 3 also annotations.
+	// Zero when the document is not certified.
+	CertificationLevel int `json:"certification_level"`
 }
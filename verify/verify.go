@@ -77,6 +77,10 @@ func VerifyWithOptions(file io.ReaderAt, size int64, options *VerifyOptions) (ap
 		documentInfo.Pages = int(pages.Int64())
 	}
 
+	// The certification signature is referenced by the DocMDP entry of the
+	// permissions dictionary
+	documentInfo.CertificationLevel = parseCertificationLevel(rdr.Trailer().Key("Root").Key("Perms").Key("DocMDP"))
+
 	// AcroForm will contain a SigFlags value if the form contains a digital signature
 	t := rdr.Trailer().Key("Root").Key("AcroForm").Key("SigFlags")
 	if t.IsNull() {
@@ -93,6 +97,12 @@ func VerifyWithOptions(file io.ReaderAt, size int64, options *VerifyOptions) (ap
 			continue
 		}
 
+		// Documents without a permissions dictionary are certified by a
+		// signature with a DocMDP reference
+		if documentInfo.CertificationLevel == 0 {
+			documentInfo.CertificationLevel = parseCertificationLevel(v)
+		}
+
 		// Use the new modular signature processing function
 		signer, errorMsg, err := processSignature(v, file, options)
 		if err != nil {